@@ -13,6 +13,8 @@ const (
 type Adder struct {
 	inputs []Outputter
 	mx     sync.RWMutex
+	buf    []float64
+	bufR   []float64
 	Activator
 }
 
@@ -49,3 +51,65 @@ func (a *Adder) Output(secs float64) float64 {
 	}
 	return sum / float64(len(a.inputs))
 }
+
+func (a *Adder) Process(ctx *ProcessContext, out []float64) {
+	zeroBuffer(out)
+	if !a.IsActive() || len(a.inputs) == 0 {
+		return
+	}
+	a.buf = growBuffer(a.buf, len(out))
+	for _, in := range a.inputs {
+		ProcessBlock(ctx, in, a.buf)
+		for i, v := range a.buf {
+			out[i] += v
+		}
+	}
+	n := float64(len(a.inputs))
+	for i := range out {
+		out[i] /= n
+	}
+}
+
+func (a *Adder) carriesStereo() bool {
+	for _, in := range a.inputs {
+		if carriesStereo(in) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Adder) OutputStereo(secs float64) (left, right float64) {
+	if !a.IsActive() || len(a.inputs) == 0 {
+		return 0, 0
+	}
+	for _, in := range a.inputs {
+		l, r := OutputStereo(in, secs)
+		left += l
+		right += r
+	}
+	n := float64(len(a.inputs))
+	return left / n, right / n
+}
+
+func (a *Adder) ProcessStereo(ctx *ProcessContext, left, right []float64) {
+	zeroBuffer(left)
+	zeroBuffer(right)
+	if !a.IsActive() || len(a.inputs) == 0 {
+		return
+	}
+	a.buf = growBuffer(a.buf, len(left))
+	a.bufR = growBuffer(a.bufR, len(right))
+	for _, in := range a.inputs {
+		ProcessStereoBlock(ctx, in, a.buf, a.bufR)
+		for i := range left {
+			left[i] += a.buf[i]
+			right[i] += a.bufR[i]
+		}
+	}
+	n := float64(len(a.inputs))
+	for i := range left {
+		left[i] /= n
+		right[i] /= n
+	}
+}
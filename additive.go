@@ -0,0 +1,145 @@
+package wavx
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// AdditiveRolloff selects the amplitudes of the harmonics, which are not set explicitly
+type AdditiveRolloff string
+
+const (
+	// AdditiveRolloffFlat gives all harmonics the same amplitude
+	AdditiveRolloffFlat AdditiveRolloff = "flat"
+	// AdditiveRolloffLinear gives the n-th harmonic the amplitude 1/n (saw-like)
+	AdditiveRolloffLinear AdditiveRolloff = "linear"
+	// AdditiveRolloffQuadratic gives the n-th harmonic the amplitude 1/n² (soft)
+	AdditiveRolloffQuadratic AdditiveRolloff = "quadratic"
+	// AdditiveRolloffOdd gives the odd harmonics the amplitude 1/n and removes the even ones (square-like)
+	AdditiveRolloffOdd AdditiveRolloff = "odd"
+)
+
+// rolloffAmpl returns the amplitude of harmonic n (1 = fundamental) according to rolloff
+func rolloffAmpl(rolloff AdditiveRolloff, n int) float64 {
+	switch rolloff {
+	case AdditiveRolloffFlat:
+		return 1
+	case AdditiveRolloffQuadratic:
+		return 1 / float64(n*n)
+	case AdditiveRolloffOdd:
+		if n%2 == 0 {
+			return 0
+		}
+		return 1 / float64(n)
+	default:
+		return 1 / float64(n)
+	}
+}
+
+// Harmonic overrides the rolloff for a single harmonic; Phase is in cycles
+type Harmonic struct {
+	Ampl  float64
+	Phase float64
+}
+
+// SetHarmonic sets amplitude and phase of harmonic n (1 = fundamental)
+func (o *StdOscillator) SetHarmonic(n int, h Harmonic) error {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+	if n < 1 {
+		return errors.Errorf("no such harmonic %d", n)
+	}
+	if o.harmonics == nil {
+		o.harmonics = map[int]Harmonic{}
+	}
+	o.harmonics[n] = h
+	o.harmonicTable = nil
+	return nil
+}
+
+// ChangeHarmonic applies cmd (e.g. ampl:0.5, phase:0.25) to harmonic n. A harmonic which wasn't set before
+// starts with its rolloff amplitude.
+func (o *StdOscillator) ChangeHarmonic(n int, cmd Command) error {
+	h, ok := o.Harmonic(n)
+	if !ok {
+		h = Harmonic{Ampl: rolloffAmpl(o.Parameters().Rolloff, n)}
+	}
+	err := ApplyCommand(cmd, &h)
+	if err != nil {
+		return errors.Wrapf(err, "harmonic %d", n)
+	}
+	return o.SetHarmonic(n, h)
+}
+
+// Harmonic returns the explicitly set harmonic n
+func (o *StdOscillator) Harmonic(n int) (Harmonic, bool) {
+	o.mx.RLock()
+	defer o.mx.RUnlock()
+	h, ok := o.harmonics[n]
+	return h, ok
+}
+
+// ResetHarmonics removes all explicitly set harmonics, so that the rolloff applies again
+func (o *StdOscillator) ResetHarmonics() {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+	o.harmonics = nil
+	o.harmonicTable = nil
+}
+
+// snapshot returns the params and, for the additive type, the table of the fundamental and params.Overtones harmonics.
+// The table is only built again after the harmonics, the rolloff or the number of overtones changed; it is never
+// modified afterwards, so it may be read without the lock.
+func (o *StdOscillator) snapshot() (StdOscillatorParams, []Harmonic) {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+	params := o.Params
+	if params.Type != StdOscillatorAdditive {
+		return params, nil
+	}
+	n := params.Overtones + 1
+	if n < 0 {
+		n = 0
+	}
+	if o.harmonicTable == nil || len(o.harmonicTable) != n || o.harmonicRolloff != params.Rolloff {
+		table := make([]Harmonic, n)
+		for i := range table {
+			h, ok := o.harmonics[i+1]
+			if !ok {
+				h = Harmonic{Ampl: rolloffAmpl(params.Rolloff, i+1)}
+			}
+			table[i] = h
+		}
+		o.harmonicTable = table
+		o.harmonicRolloff = params.Rolloff
+	}
+	return params, o.harmonicTable
+}
+
+// additive sums the harmonics of the table (see snapshot). Brightness b in [0, 1] weights the n-th harmonic by b^(n-1).
+// The sum is normalized to the power of a single sine, so neither the number of harmonics nor the brightness change the loudness.
+// Harmonics above the nyquist frequency are left out.
+func (o *StdOscillator) additive(params StdOscillatorParams, harmonics []Harmonic, brightness float64) float64 {
+	if brightness < 0 {
+		brightness = 0
+	} else if brightness > 1 {
+		brightness = 1
+	}
+	var sum, power float64
+	weight := 1.0
+	for i, h := range harmonics {
+		n := i + 1
+		a := h.Ampl * weight
+		weight *= brightness
+		power += a * a
+		if a == 0 || o.inc*float64(n) >= 0.5 {
+			continue
+		}
+		sum += a * math.Sin(2*math.Pi*(float64(n)*o.phase+h.Phase))
+	}
+	if power == 0 {
+		return 0
+	}
+	return params.Ampl * sum / math.Sqrt(power)
+}
@@ -0,0 +1,87 @@
+package wavx
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func rms(buf []float64) float64 {
+	var sum float64
+	for _, v := range buf {
+		sum += v * v
+	}
+	return math.Sqrt(sum / float64(len(buf)))
+}
+
+func TestAdditiveLoudness(t *testing.T) {
+	for _, rolloff := range []AdditiveRolloff{AdditiveRolloffFlat, AdditiveRolloffLinear, AdditiveRolloffQuadratic, AdditiveRolloffOdd} {
+		for _, overtones := range []int{0, 3, 20} {
+			for _, brightness := range []float64{0.2, 1} {
+				osc := NewStdOscillator(StdOscillatorAdditive, 100, 1, overtones)
+				osc.Execute(Command{"rolloff": string(rolloff), "brightness": fmt.Sprintf("%f", brightness)})
+				buf := make([]float64, 10000)
+				osc.Process(&ProcessContext{SampleRate: 10000}, buf)
+				if have := rms(buf); math.Abs(have-1/math.Sqrt2) > 0.01 {
+					t.Errorf("%s, %d overtones, brightness %f: rms %f", rolloff, overtones, brightness, have)
+				}
+			}
+		}
+	}
+}
+
+func TestAdditiveHarmonics(t *testing.T) {
+	osc := NewStdOscillator(StdOscillatorAdditive, 100, 1, 3)
+	osc.Execute(Command{"rolloff": string(AdditiveRolloffOdd), "h2.ampl": "0.5", "h4.ampl": "0", "h3.phase": "0.25"})
+	buf := make([]float64, 10000)
+	osc.Process(&ProcessContext{SampleRate: 10000}, buf)
+
+	// amplitude of the partial with k cycles in buf
+	partial := func(k int) float64 {
+		var re, im float64
+		for i, v := range buf {
+			s, c := math.Sincos(2 * math.Pi * float64(k*i) / float64(len(buf)))
+			re += v * c
+			im -= v * s
+		}
+		return 2 * math.Hypot(re, im) / float64(len(buf))
+	}
+	norm := math.Sqrt(1 + 0.25 + 1.0/9)
+	want := map[int]float64{100: 1 / norm, 200: 0.5 / norm, 300: 1.0 / 3 / norm, 400: 0}
+	for k, w := range want {
+		if have := partial(k); math.Abs(have-w) > 1e-3 {
+			t.Errorf("harmonic %d: want %f, have %f", k/100, w, have)
+		}
+	}
+}
+
+func TestAdditiveHarmonicChanges(t *testing.T) {
+	osc := NewStdOscillator(StdOscillatorAdditive, 100, 1, 0)
+	ctx := &ProcessContext{SampleRate: 10000}
+	buf := make([]float64, 10000)
+	osc.Process(ctx, buf)
+	if have := rms(buf); math.Abs(have-1/math.Sqrt2) > 0.01 {
+		t.Fatalf("fundamental: rms %f", have)
+	}
+
+	// the cached harmonic table follows changes of the overtones and the harmonics
+	osc.Execute(Command{"overtones": "1", "h1.ampl": "0", "h2.ampl": "0.5"})
+	ctx.Frame += uint64(len(buf))
+	osc.Process(ctx, buf)
+	var crossings int
+	for i := 1; i < len(buf); i++ {
+		if buf[i-1] < 0 && buf[i] >= 0 {
+			crossings++
+		}
+	}
+	if crossings < 199 || crossings > 201 {
+		t.Fatalf("want the second harmonic only, have %d upward crossings", crossings)
+	}
+
+	osc.ResetHarmonics()
+	osc.ChangeOvertones(-3)
+	osc.Process(ctx, buf)
+	if have := rms(buf); have != 0 {
+		t.Fatalf("no harmonics: rms %f", have)
+	}
+}
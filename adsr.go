@@ -0,0 +1,204 @@
+package wavx
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/mazzegi/log"
+)
+
+const (
+	// ADSRInputGate starts the envelope when it rises above 0 and releases it when it falls back to 0 or below
+	ADSRInputGate = "gate"
+)
+
+// ADSR is an envelope component, which outputs its level in [0, 1]. It is triggered by the gate input,
+// by Execute (gate:on, gate:off) or by Activate (note on) and Deactivate (note off).
+// Besides ADSR it runs all other EnvelopeParams, see NewEnvelopeComponent.
+type ADSR struct {
+	mx        sync.RWMutex
+	Params    EnvelopeParams
+	env       *Envelope
+	gateInput Outputter
+	gateBuf   []float64
+	gateHigh  bool
+	gateOn    bool
+	gateOff   bool
+}
+
+func NewADSR(attack, decay, sustain, release float64) *ADSR {
+	params := EnvelopeParams{
+		Attack:  attack,
+		Decay:   decay,
+		Sustain: sustain,
+		Release: release,
+	}
+	return &ADSR{
+		Params: params,
+		env:    NewEnvelope(params),
+	}
+}
+
+// NewEnvelopeComponent creates an envelope component of any params, e.g. with delay and hold stages (DAHDSR) or breakpoints
+func NewEnvelopeComponent(params EnvelopeParams) (*ADSR, error) {
+	err := params.validate()
+	if err != nil {
+		return nil, err
+	}
+	return &ADSR{
+		Params: params,
+		env:    NewEnvelope(params),
+	}, nil
+}
+
+func (a *ADSR) Inputs() []string {
+	return []string{
+		ADSRInputGate,
+	}
+}
+
+func (a *ADSR) ConnectInput(input string, op Outputter) {
+	switch input {
+	case ADSRInputGate:
+		a.gateInput = op
+	default:
+		log.Warnf("no such input %q", input)
+	}
+}
+
+func (a *ADSR) Activate() {
+	a.GateOn()
+}
+
+func (a *ADSR) Deactivate() {
+	a.GateOff()
+}
+
+// GateOn starts the envelope with the next sample
+func (a *ADSR) GateOn() {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	a.gateOn = true
+	a.gateOff = false
+}
+
+// GateOff releases the envelope with the next sample
+func (a *ADSR) GateOff() {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	a.gateOff = true
+	a.gateOn = false
+}
+
+// Execute changes the params (e.g. attack:0.1) and triggers the envelope with gate:on or gate:off
+func (a *ADSR) Execute(cmd Command) {
+	params := a.Parameters()
+	rest := Command{}
+	for k, v := range cmd {
+		if k != "gate" {
+			rest[k] = v
+			continue
+		}
+		on, err := parseGate(v)
+		if err != nil {
+			log.Warnf("adsr: %v", err)
+			return
+		}
+		if on {
+			a.GateOn()
+		} else {
+			a.GateOff()
+		}
+	}
+	if len(rest) == 0 {
+		return
+	}
+	err := ApplyCommand(rest, &params)
+	if err != nil {
+		log.Warnf("apply-command: %v", err)
+		return
+	}
+	err = params.validate()
+	if err != nil {
+		log.Warnf("adsr: %v", err)
+		return
+	}
+	a.ChangeParameters(params)
+}
+
+func parseGate(s string) (bool, error) {
+	switch s {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	default:
+		return strconv.ParseBool(s)
+	}
+}
+
+func (a *ADSR) Parameters() EnvelopeParams {
+	a.mx.RLock()
+	defer a.mx.RUnlock()
+	return a.Params
+}
+
+func (a *ADSR) ChangeParameters(params EnvelopeParams) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	a.Params = params
+	a.env.params = params
+}
+
+func (a *ADSR) Output(secs float64) float64 {
+	var gate float64
+	if a.gateInput != nil {
+		gate = a.gateInput.Output(secs)
+	}
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	return a.next(secs, gate)
+}
+
+func (a *ADSR) Process(ctx *ProcessContext, out []float64) {
+	var gate []float64
+	if a.gateInput != nil {
+		a.gateBuf = growBuffer(a.gateBuf, len(out))
+		gate = a.gateBuf
+		ProcessBlock(ctx, a.gateInput, gate)
+	}
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	for i := range out {
+		var g float64
+		if gate != nil {
+			g = gate[i]
+		}
+		out[i] = a.next(ctx.Secs(i), g)
+	}
+}
+
+// next computes the next level; mx must be locked
+func (a *ADSR) next(secs float64, gate float64) float64 {
+	if a.gateInput != nil {
+		high := gate > 0
+		if high && !a.gateHigh {
+			a.gateOn = true
+		} else if !high && a.gateHigh {
+			a.gateOff = true
+		}
+		a.gateHigh = high
+	}
+	if a.gateOn {
+		a.env.Start(secs)
+		a.gateOn = false
+	}
+	if a.gateOff {
+		a.env.Release(secs)
+		a.gateOff = false
+	}
+	if !a.env.IsActive() {
+		return 0
+	}
+	return a.env.Value(secs)
+}
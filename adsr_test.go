@@ -0,0 +1,50 @@
+package wavx
+
+import (
+	"math"
+	"testing"
+)
+
+func TestADSRGateInput(t *testing.T) {
+	const sampleRate = 1000
+	gate := NewStdOscillator(StdOscillatorSquare, 1, 1, 0)
+	env := NewADSR(0.1, 0.1, 0.5, 0.1)
+	env.ConnectInput(ADSRInputGate, gate)
+	buf := make([]float64, sampleRate)
+	env.Process(&ProcessContext{SampleRate: sampleRate}, buf)
+
+	// the square is low in the first and high in the second half
+	checks := map[int]float64{
+		250: 0,
+		550: 0.5,
+		600: 1,
+		650: 0.75,
+		900: 0.5,
+	}
+	for i, want := range checks {
+		if math.Abs(buf[i]-want) > 0.02 {
+			t.Errorf("sample %d: want %f, have %f", i, want, buf[i])
+		}
+	}
+}
+
+func TestADSRExecuteGate(t *testing.T) {
+	env := NewADSR(0, 0, 1, 0.1)
+	if v := env.Output(0); v != 0 {
+		t.Fatalf("want 0 before gate, have %f", v)
+	}
+	env.Execute(Command{"gate": "on"})
+	if v := env.Output(0.1); v != 1 {
+		t.Fatalf("want 1 after gate on, have %f", v)
+	}
+	env.Execute(Command{"gate": "off", "release": "0.2"})
+	if v := env.Output(0.2); v != 1 {
+		t.Fatalf("want 1 at release, have %f", v)
+	}
+	if v := env.Output(0.3); math.Abs(v-0.5) > 1e-9 {
+		t.Fatalf("want 0.5 after half the release, have %f", v)
+	}
+	if v := env.Output(0.5); v != 0 {
+		t.Fatalf("want 0 after release, have %f", v)
+	}
+}
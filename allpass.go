@@ -4,24 +4,24 @@ type AllPassFilter struct {
 	Gain         float64
 	DelayMsec    float64
 	SamplingRate float64
-	bufferX      *LinearBuffer
-	bufferY      *LinearBuffer
+	lineX        *DelayLine
+	lineY        *DelayLine
 }
 
 func NewAllPassFilter(gain, delayMsec, samplingRate float64) *AllPassFilter {
-	delSamples := int(samplingRate / 1000.0 * delayMsec)
+	delSamples := delaySamples(delayMsec, samplingRate)
 	return &AllPassFilter{
 		Gain:         gain,
 		DelayMsec:    delayMsec,
 		SamplingRate: samplingRate,
-		bufferX:      NewLinearBuffer(delSamples),
-		bufferY:      NewLinearBuffer(delSamples),
+		lineX:        NewDelayLine(delSamples),
+		lineY:        NewDelayLine(delSamples),
 	}
 }
 
 func (f *AllPassFilter) Next(x float64) float64 {
-	y := -f.Gain*x + f.bufferX.FirstValue() + f.Gain*f.bufferY.FirstValue()
-	f.bufferX.Push(x)
-	f.bufferY.Push(y)
+	y := -f.Gain*x + f.lineX.Tap(f.lineX.Size()) + f.Gain*f.lineY.Tap(f.lineY.Size())
+	f.lineX.Write(x)
+	f.lineY.Write(y)
 	return y
 }
@@ -1,16 +1,31 @@
 package wavx
 
-import "github.com/mazzegi/log"
+import (
+	"sync"
 
+	"github.com/mazzegi/log"
+)
+
+// AmplituderParams holds the base amplitude, to which the modulation is added
+type AmplituderParams struct {
+	Ampl float64
+}
+
+// Amplituder scales a signal; stereo signals are scaled on both channels
 type Amplituder struct {
-	baseAmplitude   float64
+	mx              sync.RWMutex
+	Params          AmplituderParams
 	inputSignal     Outputter
 	inputModulation Outputter
+	modBuf          []float64
+	Activator
 }
 
 func NewAmplituder(baseAmpl float64) *Amplituder {
 	return &Amplituder{
-		baseAmplitude: baseAmpl,
+		Params: AmplituderParams{
+			Ampl: baseAmpl,
+		},
 	}
 }
 
@@ -37,13 +52,101 @@ func (a *Amplituder) ConnectInput(input string, op Outputter) {
 	}
 }
 
+func (a *Amplituder) Execute(cmd Command) {
+	params := a.Parameters()
+	err := ApplyCommand(cmd, &params)
+	if err != nil {
+		log.Warnf("apply-command: %v", err)
+		return
+	}
+	a.ChangeParameters(params)
+}
+
+func (a *Amplituder) Parameters() AmplituderParams {
+	a.mx.RLock()
+	defer a.mx.RUnlock()
+	return a.Params
+}
+
+func (a *Amplituder) ChangeParameters(params AmplituderParams) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	a.Params = params
+}
+
 func (a *Amplituder) Output(secs float64) float64 {
 	if a.inputSignal == nil {
 		return 0
 	}
-	ampl := a.baseAmplitude
+	if !a.IsActive() {
+		return a.inputSignal.Output(secs)
+	}
+	ampl := a.Parameters().Ampl
 	if a.inputModulation != nil {
 		ampl += a.inputModulation.Output(secs)
 	}
 	return ampl * a.inputSignal.Output(secs)
 }
+
+func (a *Amplituder) carriesStereo() bool {
+	return a.inputSignal != nil && carriesStereo(a.inputSignal)
+}
+
+func (a *Amplituder) OutputStereo(secs float64) (left, right float64) {
+	if a.inputSignal == nil {
+		return 0, 0
+	}
+	left, right = OutputStereo(a.inputSignal, secs)
+	if !a.IsActive() {
+		return left, right
+	}
+	ampl := a.Parameters().Ampl
+	if a.inputModulation != nil {
+		ampl += a.inputModulation.Output(secs)
+	}
+	return ampl * left, ampl * right
+}
+
+func (a *Amplituder) Process(ctx *ProcessContext, out []float64) {
+	if a.inputSignal == nil {
+		zeroBuffer(out)
+		return
+	}
+	ProcessBlock(ctx, a.inputSignal, out)
+	a.scale(ctx, out, nil)
+}
+
+func (a *Amplituder) ProcessStereo(ctx *ProcessContext, left, right []float64) {
+	if a.inputSignal == nil {
+		zeroBuffer(left)
+		zeroBuffer(right)
+		return
+	}
+	ProcessStereoBlock(ctx, a.inputSignal, left, right)
+	a.scale(ctx, left, right)
+}
+
+// scale scales the block in place; right is nil for a mono block
+func (a *Amplituder) scale(ctx *ProcessContext, left, right []float64) {
+	if !a.IsActive() {
+		return
+	}
+	ampl := a.Parameters().Ampl
+	if a.inputModulation == nil {
+		for i := range left {
+			left[i] *= ampl
+			if right != nil {
+				right[i] *= ampl
+			}
+		}
+		return
+	}
+	a.modBuf = growBuffer(a.modBuf, len(left))
+	ProcessBlock(ctx, a.inputModulation, a.modBuf)
+	for i := range left {
+		left[i] *= ampl + a.modBuf[i]
+		if right != nil {
+			right[i] *= ampl + a.modBuf[i]
+		}
+	}
+}
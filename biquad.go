@@ -0,0 +1,332 @@
+package wavx
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+
+	"github.com/mazzegi/log"
+)
+
+type BiquadType string
+
+const (
+	BiquadLowPass   BiquadType = "lowpass"
+	BiquadHighPass  BiquadType = "highpass"
+	BiquadBandPass  BiquadType = "bandpass"
+	BiquadNotch     BiquadType = "notch"
+	BiquadPeaking   BiquadType = "peaking"
+	BiquadLowShelf  BiquadType = "lowshelf"
+	BiquadHighShelf BiquadType = "highshelf"
+	BiquadAllPass   BiquadType = "allpass"
+)
+
+const (
+	BiquadInputSignal = "signal"
+	// BiquadInputCutoffOctaveModulation is in octaves, so +1 doubles the cutoff
+	BiquadInputCutoffOctaveModulation = "cutoff-octave-modulation"
+	// BiquadInputCutoffModulation is the input name of Filter, which is accepted as an alias of BiquadInputCutoffOctaveModulation
+	BiquadInputCutoffModulation = FilterInputCutoffModulation
+	// BiquadInputResonanceModulation is added to Q
+	BiquadInputResonanceModulation = "resonance-modulation"
+)
+
+const (
+	minBiquadCutoff = 10.0
+	minBiquadQ      = 0.01
+	// biquadModulationInterval is the number of samples, after which the coefficients follow the modulation
+	biquadModulationInterval = 16
+)
+
+// BiquadParams holds the biquad params; Cutoff is in Hz, Gain in dB (only used by peaking and shelf filters)
+type BiquadParams struct {
+	Type   BiquadType
+	Cutoff float64
+	Q      float64
+	Gain   float64
+}
+
+// BiquadCoefficients are the normalized coefficients (a0 = 1) of a biquad
+type BiquadCoefficients struct {
+	B0, B1, B2 float64
+	A1, A2     float64
+}
+
+// NewBiquadCoefficients computes the coefficients of the RBJ audio EQ cookbook
+func NewBiquadCoefficients(typ BiquadType, cutoff, q, gain float64, sampleRate int) BiquadCoefficients {
+	sr := float64(sampleRate)
+	cutoff = math.Max(minBiquadCutoff, math.Min(cutoff, 0.49*sr))
+	q = math.Max(minBiquadQ, q)
+	w0 := 2 * math.Pi * cutoff / sr
+	sinW0, cosW0 := math.Sincos(w0)
+	alpha := sinW0 / (2 * q)
+	a := math.Pow(10, gain/40)
+
+	var b0, b1, b2, a0, a1, a2 float64
+	switch typ {
+	case BiquadHighPass:
+		b0, b1, b2 = (1+cosW0)/2, -(1 + cosW0), (1+cosW0)/2
+		a0, a1, a2 = 1+alpha, -2*cosW0, 1-alpha
+	case BiquadBandPass:
+		// constant 0 dB peak gain
+		b0, b1, b2 = alpha, 0, -alpha
+		a0, a1, a2 = 1+alpha, -2*cosW0, 1-alpha
+	case BiquadNotch:
+		b0, b1, b2 = 1, -2*cosW0, 1
+		a0, a1, a2 = 1+alpha, -2*cosW0, 1-alpha
+	case BiquadPeaking:
+		b0, b1, b2 = 1+alpha*a, -2*cosW0, 1-alpha*a
+		a0, a1, a2 = 1+alpha/a, -2*cosW0, 1-alpha/a
+	case BiquadLowShelf:
+		sq := 2 * math.Sqrt(a) * alpha
+		b0, b1, b2 = a*((a+1)-(a-1)*cosW0+sq), 2*a*((a-1)-(a+1)*cosW0), a*((a+1)-(a-1)*cosW0-sq)
+		a0, a1, a2 = (a+1)+(a-1)*cosW0+sq, -2*((a-1)+(a+1)*cosW0), (a+1)+(a-1)*cosW0-sq
+	case BiquadHighShelf:
+		sq := 2 * math.Sqrt(a) * alpha
+		b0, b1, b2 = a*((a+1)+(a-1)*cosW0+sq), -2*a*((a-1)+(a+1)*cosW0), a*((a+1)+(a-1)*cosW0-sq)
+		a0, a1, a2 = (a+1)-(a-1)*cosW0+sq, 2*((a-1)-(a+1)*cosW0), (a+1)-(a-1)*cosW0-sq
+	case BiquadAllPass:
+		b0, b1, b2 = 1-alpha, -2*cosW0, 1+alpha
+		a0, a1, a2 = 1+alpha, -2*cosW0, 1-alpha
+	default:
+		b0, b1, b2 = (1-cosW0)/2, 1-cosW0, (1-cosW0)/2
+		a0, a1, a2 = 1+alpha, -2*cosW0, 1-alpha
+	}
+	return BiquadCoefficients{
+		B0: b0 / a0,
+		B1: b1 / a0,
+		B2: b2 / a0,
+		A1: a1 / a0,
+		A2: a2 / a0,
+	}
+}
+
+// Magnitude returns the gain of the filter at freq
+func (c BiquadCoefficients) Magnitude(freq float64, sampleRate int) float64 {
+	w := 2 * math.Pi * freq / float64(sampleRate)
+	z1 := cmplx.Exp(complex(0, -w))
+	z2 := z1 * z1
+	num := complex(c.B0, 0) + complex(c.B1, 0)*z1 + complex(c.B2, 0)*z2
+	den := 1 + complex(c.A1, 0)*z1 + complex(c.A2, 0)*z2
+	return cmplx.Abs(num / den)
+}
+
+// biquadState is the state of a biquad in transposed direct form II
+type biquadState struct {
+	z1, z2 float64
+}
+
+func (s *biquadState) next(c *BiquadCoefficients, x float64) float64 {
+	y := c.B0*x + s.z1
+	s.z1 = c.B1*x - c.A1*y + s.z2
+	s.z2 = c.B2*x - c.A2*y
+	return y
+}
+
+// Biquad is a sample-rate aware second order filter; stereo signals are filtered per channel.
+// The per-sample Output assumes SampelRate44100, unless the sample rate is set by SetSampleRate or by a previous Process.
+type Biquad struct {
+	mx                 sync.RWMutex
+	Params             BiquadParams
+	inputSignal        Outputter
+	inputCutoffMod     Outputter
+	inputResonanceMod  Outputter
+	cutoffModBuf       []float64
+	resonanceModBuf    []float64
+	sampleRate         int
+	states             [2]biquadState
+	coeffs             BiquadCoefficients
+	coeffsParams       BiquadParams
+	coeffsCutoffMod    float64
+	coeffsResonanceMod float64
+	coeffsSampleRate   int
+	coeffsAge          int
+	Activator
+}
+
+func NewBiquad(typ BiquadType, cutoff float64, q float64, gain float64) *Biquad {
+	return &Biquad{
+		Params: BiquadParams{
+			Type:   typ,
+			Cutoff: cutoff,
+			Q:      q,
+			Gain:   gain,
+		},
+		sampleRate: SampelRate44100,
+	}
+}
+
+func (f *Biquad) Inputs() []string {
+	return []string{
+		BiquadInputSignal,
+		BiquadInputCutoffOctaveModulation,
+		BiquadInputCutoffModulation,
+		BiquadInputResonanceModulation,
+	}
+}
+
+func (f *Biquad) ConnectInput(input string, op Outputter) {
+	switch input {
+	case BiquadInputSignal:
+		f.inputSignal = op
+	case BiquadInputCutoffOctaveModulation, BiquadInputCutoffModulation:
+		f.inputCutoffMod = op
+	case BiquadInputResonanceModulation:
+		f.inputResonanceMod = op
+	default:
+		log.Warnf("no such input %q", input)
+	}
+}
+
+func (f *Biquad) Execute(cmd Command) {
+	params := f.Parameters()
+	err := ApplyCommand(cmd, &params)
+	if err != nil {
+		log.Warnf("apply-command: %v", err)
+		return
+	}
+	f.ChangeParameters(params)
+}
+
+func (f *Biquad) Parameters() BiquadParams {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	return f.Params
+}
+
+func (f *Biquad) ChangeParameters(params BiquadParams) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.Params = params
+}
+
+func (f *Biquad) SetSampleRate(sampleRate int) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.sampleRate = sampleRate
+}
+
+// coefficients returns the coefficients for the next sample; mx must be locked. They are computed again at once,
+// if the params or the sample rate change, but only every biquadModulationInterval samples, if the modulation changes.
+func (f *Biquad) coefficients(cutoffMod, resonanceMod float64, sampleRate int) *BiquadCoefficients {
+	f.coeffsAge++
+	modChanged := cutoffMod != f.coeffsCutoffMod || resonanceMod != f.coeffsResonanceMod
+	if f.Params != f.coeffsParams || sampleRate != f.coeffsSampleRate || (modChanged && f.coeffsAge >= biquadModulationInterval) {
+		params := modulatedBiquadParams(f.Params, cutoffMod, resonanceMod)
+		f.coeffs = NewBiquadCoefficients(params.Type, params.Cutoff, params.Q, params.Gain, sampleRate)
+		f.coeffsParams = f.Params
+		f.coeffsCutoffMod = cutoffMod
+		f.coeffsResonanceMod = resonanceMod
+		f.coeffsSampleRate = sampleRate
+		f.coeffsAge = 0
+	}
+	return &f.coeffs
+}
+
+func (f *Biquad) carriesStereo() bool {
+	return f.inputSignal != nil && carriesStereo(f.inputSignal)
+}
+
+// modulation returns the cutoff and the resonance modulation at secs
+func (f *Biquad) modulation(secs float64) (cutoffMod, resonanceMod float64) {
+	if f.inputCutoffMod != nil {
+		cutoffMod = f.inputCutoffMod.Output(secs)
+	}
+	if f.inputResonanceMod != nil {
+		resonanceMod = f.inputResonanceMod.Output(secs)
+	}
+	return cutoffMod, resonanceMod
+}
+
+func (f *Biquad) Output(secs float64) float64 {
+	if f.inputSignal == nil {
+		return 0
+	}
+	v := f.inputSignal.Output(secs)
+	if !f.IsActive() {
+		return v
+	}
+	cutoffMod, resonanceMod := f.modulation(secs)
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return f.states[0].next(f.coefficients(cutoffMod, resonanceMod, f.sampleRate), v)
+}
+
+func (f *Biquad) OutputStereo(secs float64) (left, right float64) {
+	if !f.carriesStereo() {
+		v := f.Output(secs)
+		return v, v
+	}
+	left, right = OutputStereo(f.inputSignal, secs)
+	if !f.IsActive() {
+		return left, right
+	}
+	cutoffMod, resonanceMod := f.modulation(secs)
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	c := f.coefficients(cutoffMod, resonanceMod, f.sampleRate)
+	return f.states[0].next(c, left), f.states[1].next(c, right)
+}
+
+func (f *Biquad) Process(ctx *ProcessContext, out []float64) {
+	if f.inputSignal == nil {
+		zeroBuffer(out)
+		return
+	}
+	ProcessBlock(ctx, f.inputSignal, out)
+	f.filter(ctx, out, nil)
+}
+
+func (f *Biquad) ProcessStereo(ctx *ProcessContext, left, right []float64) {
+	if !f.carriesStereo() {
+		f.Process(ctx, left)
+		copy(right, left)
+		return
+	}
+	ProcessStereoBlock(ctx, f.inputSignal, left, right)
+	f.filter(ctx, left, right)
+}
+
+// filter filters the block in place; right is nil for a mono block
+func (f *Biquad) filter(ctx *ProcessContext, left, right []float64) {
+	if !f.IsActive() {
+		return
+	}
+	var cutoffMod, resonanceMod []float64
+	if f.inputCutoffMod != nil {
+		f.cutoffModBuf = growBuffer(f.cutoffModBuf, len(left))
+		cutoffMod = f.cutoffModBuf
+		ProcessBlock(ctx, f.inputCutoffMod, cutoffMod)
+	}
+	if f.inputResonanceMod != nil {
+		f.resonanceModBuf = growBuffer(f.resonanceModBuf, len(left))
+		resonanceMod = f.resonanceModBuf
+		ProcessBlock(ctx, f.inputResonanceMod, resonanceMod)
+	}
+
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.sampleRate = ctx.SampleRate
+	for i, v := range left {
+		var cm, rm float64
+		if cutoffMod != nil {
+			cm = cutoffMod[i]
+		}
+		if resonanceMod != nil {
+			rm = resonanceMod[i]
+		}
+		c := f.coefficients(cm, rm, ctx.SampleRate)
+		left[i] = f.states[0].next(c, v)
+		if right != nil {
+			right[i] = f.states[1].next(c, right[i])
+		}
+	}
+}
+
+func modulatedBiquadParams(params BiquadParams, cutoffMod, resonanceMod float64) BiquadParams {
+	if cutoffMod != 0 {
+		params.Cutoff *= math.Pow(2, cutoffMod)
+	}
+	params.Q += resonanceMod
+	return params
+}
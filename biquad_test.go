@@ -0,0 +1,112 @@
+package wavx
+
+import (
+	"math"
+	"testing"
+)
+
+func dB(v float64) float64 {
+	return 20 * math.Log10(v)
+}
+
+func TestBiquadMagnitude(t *testing.T) {
+	tests := []struct {
+		typ    BiquadType
+		gain   float64
+		freq   float64
+		wantDB float64
+	}{
+		{BiquadLowPass, 0, 1000, -3.01},
+		{BiquadLowPass, 0, 50, 0},
+		{BiquadHighPass, 0, 1000, -3.01},
+		{BiquadHighPass, 0, 15000, 0},
+		{BiquadBandPass, 0, 1000, 0},
+		{BiquadPeaking, 6, 1000, 6},
+		{BiquadPeaking, 6, 30, 0},
+		{BiquadLowShelf, -6, 30, -6},
+		{BiquadHighShelf, 6, 15000, 6},
+		{BiquadAllPass, 0, 1000, 0},
+		{BiquadAllPass, 0, 5000, 0},
+	}
+	for _, sampleRate := range []int{44100, 96000} {
+		for _, test := range tests {
+			c := NewBiquadCoefficients(test.typ, 1000, 1/math.Sqrt2, test.gain, sampleRate)
+			if have := dB(c.Magnitude(test.freq, sampleRate)); math.Abs(have-test.wantDB) > 0.1 {
+				t.Errorf("%s at %d Hz (sample rate %d): want %.2f dB, have %.2f dB", test.typ, int(test.freq), sampleRate, test.wantDB, have)
+			}
+		}
+	}
+	c := NewBiquadCoefficients(BiquadNotch, 1000, 1/math.Sqrt2, 0, 44100)
+	if have := c.Magnitude(1000, 44100); have > 1e-6 {
+		t.Errorf("notch: want 0 at cutoff, have %f", have)
+	}
+}
+
+func TestBiquadProcess(t *testing.T) {
+	const sampleRate = 48000
+	for _, test := range []struct {
+		freq float64
+		want float64
+	}{
+		{100, 1},
+		{8000, 0.016},
+	} {
+		osc := NewStdOscillator(StdOscillatorSine, test.freq, 1, 0)
+		f := NewBiquad(BiquadLowPass, 1000, 1/math.Sqrt2, 0)
+		f.ConnectInput(BiquadInputSignal, osc)
+		buf := make([]float64, sampleRate)
+		f.Process(&ProcessContext{SampleRate: sampleRate}, buf)
+		// skip the transient
+		if have := rms(buf[sampleRate/2:]) * math.Sqrt2; math.Abs(have-test.want) > 0.01 {
+			t.Errorf("%f Hz: want amplitude %f, have %f", test.freq, test.want, have)
+		}
+	}
+}
+
+func TestBiquadCutoffModulation(t *testing.T) {
+	const sampleRate = 48000
+	// the input name of Filter is an alias of the octave modulation
+	for _, input := range []string{BiquadInputCutoffOctaveModulation, BiquadInputCutoffModulation} {
+		osc := NewStdOscillator(StdOscillatorSine, 2000, 1, 0)
+		mod := NewStdOscillator(StdOscillatorSine, 0, 1, 0)
+		// a sine of 0 Hz at a quarter cycle yields a constant modulation of +1 octave
+		mod.phase = 0.25
+		f := NewBiquad(BiquadLowPass, 1000, 1/math.Sqrt2, 0)
+		f.ConnectInput(BiquadInputSignal, osc)
+		f.ConnectInput(input, mod)
+		buf := make([]float64, sampleRate)
+		f.Process(&ProcessContext{SampleRate: sampleRate}, buf)
+		if have := dB(rms(buf[sampleRate/2:]) * math.Sqrt2); math.Abs(have+3.01) > 0.1 {
+			t.Errorf("%s: want -3 dB at the modulated cutoff, have %.2f dB", input, have)
+		}
+	}
+}
+
+func TestBiquadModulationRate(t *testing.T) {
+	f := NewBiquad(BiquadLowPass, 1000, 1/math.Sqrt2, 0)
+	f.ConnectInput(BiquadInputSignal, NewNoise(NoiseWhite, 1, 1))
+	// a sweeping modulation changes on every sample
+	f.ConnectInput(BiquadInputCutoffOctaveModulation, NewStdOscillator(StdOscillatorSaw, 5, 1, 0))
+	ctx := &ProcessContext{SampleRate: SampelRate44100}
+	buf := make([]float64, 1)
+	var updates int
+	last := f.coeffs
+	for i := 0; i < 16*biquadModulationInterval; i++ {
+		f.Process(ctx, buf)
+		ctx.Frame++
+		if f.coeffs != last {
+			updates++
+			last = f.coeffs
+		}
+	}
+	if updates < 15 || updates > 17 {
+		t.Fatalf("want the coefficients to follow the modulation every %d samples, have %d updates", biquadModulationInterval, updates)
+	}
+
+	// changes of the params apply at once
+	f.Execute(Command{"cutoff": "2000"})
+	f.Process(ctx, buf)
+	if f.coeffs == last {
+		t.Fatalf("want new coefficients after a change of the cutoff")
+	}
+}
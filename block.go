@@ -0,0 +1,56 @@
+package wavx
+
+// ProcessContext describes the block of frames which is processed
+type ProcessContext struct {
+	SampleRate int
+	// Frame is the index of the first frame of the block
+	Frame uint64
+}
+
+// Secs returns the time of the i-th frame of the block
+func (ctx *ProcessContext) Secs(i int) float64 {
+	return float64(ctx.Frame+uint64(i)) / float64(ctx.SampleRate)
+}
+
+// BlockProcessor is implemented by components which compute a whole block of samples at once.
+// Parameters are read once per block instead of once per sample.
+type BlockProcessor interface {
+	Process(ctx *ProcessContext, out []float64)
+}
+
+// ProcessBlock fills out with the next block of op. Components which are no BlockProcessor are sampled per sample,
+// so they can be mixed with block based components.
+func ProcessBlock(ctx *ProcessContext, op Outputter, out []float64) {
+	if bp, ok := op.(BlockProcessor); ok {
+		bp.Process(ctx, out)
+		return
+	}
+	for i := range out {
+		out[i] = op.Output(ctx.Secs(i))
+	}
+}
+
+// SampleAdapter makes a per-sample Outputter usable as a BlockProcessor
+type SampleAdapter struct {
+	Outputter
+}
+
+func (a SampleAdapter) Process(ctx *ProcessContext, out []float64) {
+	for i := range out {
+		out[i] = a.Output(ctx.Secs(i))
+	}
+}
+
+// growBuffer returns buf with length n; it is only reallocated if its capacity is too small
+func growBuffer(buf []float64, n int) []float64 {
+	if cap(buf) < n {
+		return make([]float64, n)
+	}
+	return buf[:n]
+}
+
+func zeroBuffer(buf []float64) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
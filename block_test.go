@@ -0,0 +1,65 @@
+package wavx
+
+import (
+	"math"
+	"testing"
+)
+
+func newTestGraph() Outputter {
+	osc1 := NewStdOscillator(StdOscillatorSaw, 220, 1.0, 2)
+	osc1.ConnectInput(StdOscillatorInputFreqMod, NewLFO(StdOscillatorSine, 0, 0.2, 3))
+	osc2 := NewStdOscillator(StdOscillatorSquare, 110, 0.5, 0)
+
+	adder := NewAdder()
+	adder.ConnectInput(AdderInput, osc1)
+	adder.ConnectInput(AdderInput, osc2)
+
+	filter := NewFilter(FilterModeLowPass, 0.3, 0.5)
+	filter.ConnectInput(FilterInputSignal, adder)
+	filter.ConnectInput(FilterInputCutoffModulation, NewLFO(StdOscillatorSine, 0, 0.2, 3))
+
+	dist := NewDistortion(0.6)
+	dist.ConnectInput(DistortionInputSignal, filter)
+
+	ampl := NewAmplituder(0.8)
+	ampl.ConnectInput(AmplitudeInputSignal, dist)
+	ampl.ConnectInput(AmplitudeInputModulation, NewLFO(StdOscillatorSine, 0, 0.1, 0.5))
+	return ampl
+}
+
+func TestProcessMatchesOutput(t *testing.T) {
+	perSample := NewSynthesizer(SampelRate44100, SampleAdapter{newTestGraph()}, nil)
+	perSample.SetChannels(1)
+	block := NewSynthesizer(SampelRate44100, newTestGraph(), nil)
+	block.SetChannels(1)
+
+	want := make([]float64, 1000)
+	have := make([]float64, 1000)
+	for n := 0; n < 10; n++ {
+		perSample.Render(want)
+		block.Render(have)
+		for i := range want {
+			if math.Abs(want[i]-have[i]) > 1e-12 {
+				t.Fatalf("block %d, sample %d: want %f, have %f", n, i, want[i], have[i])
+			}
+		}
+	}
+}
+
+func BenchmarkRenderPerSample(b *testing.B) {
+	synth := NewSynthesizer(SampelRate44100, SampleAdapter{newTestGraph()}, nil)
+	synth.SetChannels(1)
+	buf := make([]float64, DefaultFramesPerBuffer)
+	for i := 0; i < b.N; i++ {
+		synth.Render(buf)
+	}
+}
+
+func BenchmarkRenderBlock(b *testing.B) {
+	synth := NewSynthesizer(SampelRate44100, newTestGraph(), nil)
+	synth.SetChannels(1)
+	buf := make([]float64, DefaultFramesPerBuffer)
+	for i := 0; i < b.N; i++ {
+		synth.Render(buf)
+	}
+}
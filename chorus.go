@@ -1,38 +1,242 @@
 package wavx
 
+import (
+	"math"
+	"sync"
+
+	"github.com/mazzegi/log"
+)
+
+const (
+	ChorusInputSignal = "signal"
+	// ChorusInputDelayModulation is added to the delay time in ms
+	ChorusInputDelayModulation = "delay-modulation"
+)
+
+const (
+	// maxModDelaySecs is the longest delay of the modulation effects (chorus, flanger)
+	maxModDelaySecs = 0.25
+	// maxModFeedback keeps the feedback loop of the modulation effects below unity gain
+	maxModFeedback = 0.95
+)
+
+// ChorusParams holds the chorus params. Delay is the center and Depth the sweep of the delay time in ms, Rate is in Hz.
+// The Voices sweep with evenly spread phases and are placed across the stereo field by Spread in [0, 1].
+// Feedback ranges from -1 to 1, Mix from 0 (dry) to 1 (wet).
+type ChorusParams struct {
+	Delay    float64
+	Depth    float64
+	Rate     float64
+	Voices   int
+	Spread   float64
+	Feedback float64
+	Mix      float64
+}
+
+// modDelay is a delay line, which is read at a modulated fractional position. Changes of the center delay glide,
+// so that sweeping or changing the delay doesn't click.
+type modDelay struct {
+	line   *DelayLine
+	center float64
+	phase  float64
+	clock  sampleClock
+}
+
+func newModDelay(sampleRate int) modDelay {
+	return modDelay{
+		line:   NewDelayLine(int(maxModDelaySecs*float64(sampleRate)) + 2),
+		center: -1,
+	}
+}
+
+// advance moves the lfo by the time since the previous sample and the center towards delay (in samples)
+func (d *modDelay) advance(secs float64, rate float64, delay float64) {
+	d.phase = fract(d.phase + rate*d.clock.elapsed(secs))
+	if d.center < 0 {
+		d.center = delay
+	} else {
+		d.center += delayGlide * (delay - d.center)
+	}
+}
+
+// tap reads the delay line at the center plus depth samples, swept with the lfo shifted by phase cycles
+func (d *modDelay) tap(depth float64, phase float64) float64 {
+	delay := d.center + depth*math.Sin(2*math.Pi*(d.phase+phase))
+	return d.line.TapCubic(math.Min(delay, float64(d.line.Size()-2)))
+}
+
+// Chorus is a multi-voice stereo chorus. The per-sample Output assumes SampelRate44100,
+// unless the sample rate is set by SetSampleRate or by a previous Process.
 type Chorus struct {
-	inputSignal Outputter
-	inputLFO    Outputter
-	delay       float64
-	sampleRate  float64
-	comb        *CombFilter
+	mx            sync.RWMutex
+	Params        ChorusParams
+	inputSignal   Outputter
+	inputDelayMod Outputter
+	delayModBuf   []float64
+	sampleRate    int
+	mod           modDelay
+	outL, outR    []float64
+	Activator
 }
 
-func NewChorus(sampleRate float64, delayMSec float64) *Chorus {
+// NewChorus creates a chorus of voices with full spread, mixed half wet
+func NewChorus(delayMsec float64, depthMsec float64, rate float64, voices int) *Chorus {
+	if voices < 1 {
+		voices = 1
+	}
 	return &Chorus{
-		comb:       NewCombFilter(0.5, delayMSec, sampleRate),
-		sampleRate: sampleRate,
-		delay:      delayMSec,
+		Params: ChorusParams{
+			Delay:  delayMsec,
+			Depth:  depthMsec,
+			Rate:   rate,
+			Voices: voices,
+			Spread: 1,
+			Mix:    0.5,
+		},
+		sampleRate: SampelRate44100,
+		mod:        newModDelay(SampelRate44100),
+	}
+}
+
+func (c *Chorus) Inputs() []string {
+	return []string{
+		ChorusInputSignal,
+		ChorusInputDelayModulation,
+	}
+}
+
+func (c *Chorus) ConnectInput(input string, op Outputter) {
+	switch input {
+	case ChorusInputSignal:
+		c.inputSignal = op
+	case ChorusInputDelayModulation:
+		c.inputDelayMod = op
+	default:
+		log.Warnf("no such input %q", input)
+	}
+}
+
+func (c *Chorus) Execute(cmd Command) {
+	params := c.Parameters()
+	err := ApplyCommand(cmd, &params)
+	if err != nil {
+		log.Warnf("apply-command: %v", err)
+		return
+	}
+	c.ChangeParameters(params)
+}
+
+func (c *Chorus) Parameters() ChorusParams {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	return c.Params
+}
+
+func (c *Chorus) ChangeParameters(params ChorusParams) {
+	if params.Voices < 1 {
+		params.Voices = 1
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.Params = params
+}
+
+func (c *Chorus) SetSampleRate(sampleRate int) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.setSampleRate(sampleRate)
+}
+
+// setSampleRate reallocates the delay line, if the sample rate changes; mx must be locked
+func (c *Chorus) setSampleRate(sampleRate int) {
+	if sampleRate == c.sampleRate {
+		return
 	}
+	c.sampleRate = sampleRate
+	c.mod = newModDelay(sampleRate)
 }
 
-func (d *Chorus) ConnectInput(op Outputter) {
-	d.inputSignal = op
+func (c *Chorus) Output(secs float64) float64 {
+	l, r := c.OutputStereo(secs)
+	return (l + r) / 2
 }
 
-func (d *Chorus) ConnectInputLFO(op Outputter) {
-	d.inputLFO = op
+func (c *Chorus) OutputStereo(secs float64) (left, right float64) {
+	if c.inputSignal == nil {
+		return 0, 0
+	}
+	l, r := OutputStereo(c.inputSignal, secs)
+	if !c.IsActive() {
+		return l, r
+	}
+	var delayMod float64
+	if c.inputDelayMod != nil {
+		delayMod = c.inputDelayMod.Output(secs)
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.next(secs, l, r, c.Params, delayMod)
 }
 
-func (d *Chorus) Output(secs float64) float64 {
-	if d.inputSignal == nil {
-		return 0
+func (c *Chorus) Process(ctx *ProcessContext, out []float64) {
+	c.outL = growBuffer(c.outL, len(out))
+	c.outR = growBuffer(c.outR, len(out))
+	c.ProcessStereo(ctx, c.outL, c.outR)
+	midBuffer(out, c.outL, c.outR)
+}
+
+func (c *Chorus) ProcessStereo(ctx *ProcessContext, left, right []float64) {
+	if c.inputSignal == nil {
+		zeroBuffer(left)
+		zeroBuffer(right)
+		return
+	}
+	ProcessStereoBlock(ctx, c.inputSignal, left, right)
+	if !c.IsActive() {
+		return
 	}
-	if d.inputLFO != nil {
-		lfo := d.inputLFO.Output(secs)
-		d.comb.Change(lfo, d.sampleRate)
+	var delayMod []float64
+	if c.inputDelayMod != nil {
+		c.delayModBuf = growBuffer(c.delayModBuf, len(left))
+		delayMod = c.delayModBuf
+		ProcessBlock(ctx, c.inputDelayMod, delayMod)
 	}
-	newVal := d.inputSignal.Output(secs)
-	c := d.comb.Next(newVal)
-	return c
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.setSampleRate(ctx.SampleRate)
+	params := c.Params
+	for i := range left {
+		var dm float64
+		if delayMod != nil {
+			dm = delayMod[i]
+		}
+		left[i], right[i] = c.next(ctx.Secs(i), left[i], right[i], params, dm)
+	}
+}
+
+// next computes the next stereo sample; mx must be locked
+func (c *Chorus) next(secs float64, l, r float64, params ChorusParams, delayMod float64) (float64, float64) {
+	msecs := float64(c.sampleRate) / 1000
+	c.mod.advance(secs, params.Rate, (params.Delay+delayMod)*msecs)
+	depth := params.Depth * msecs
+
+	var wetL, wetR, wet float64
+	n := params.Voices
+	for i := 0; i < n; i++ {
+		v := c.mod.tap(depth, float64(i)/float64(n))
+		var pos float64
+		if n > 1 {
+			pos = params.Spread * (-1 + 2*float64(i)/float64(n-1))
+		}
+		gl, gr := balanceGains(pos)
+		wetL += gl * v
+		wetR += gr * v
+		wet += v
+	}
+	norm := 1 / math.Sqrt(float64(n))
+	fb := math.Max(-maxModFeedback, math.Min(params.Feedback, maxModFeedback))
+	c.mod.line.Write((l+r)/2 + fb*wet/float64(n))
+
+	mix := clamp01(params.Mix)
+	return (1-mix)*l + mix*norm*wetL, (1-mix)*r + mix*norm*wetR
 }
@@ -0,0 +1,129 @@
+package wavx
+
+import (
+	"math"
+	"testing"
+)
+
+// maxStep returns the largest difference of adjacent samples
+func maxStep(buf []float64) float64 {
+	var m float64
+	for i := 1; i < len(buf); i++ {
+		m = math.Max(m, math.Abs(buf[i]-buf[i-1]))
+	}
+	return m
+}
+
+func TestChorusSweep(t *testing.T) {
+	const sampleRate = 44100
+	osc := NewStdOscillator(StdOscillatorSine, 440, 1, 0)
+	// the sweep reaches below a single sample and must neither crash nor click
+	c := NewChorus(2, 5, 3, 3)
+	c.ChangeParameters(ChorusParams{Delay: 2, Depth: 5, Rate: 3, Voices: 3, Spread: 1, Feedback: 0.5, Mix: 0.5})
+	c.ConnectInput(ChorusInputSignal, osc)
+	ctx := &ProcessContext{SampleRate: sampleRate}
+	left := make([]float64, sampleRate/2)
+	right := make([]float64, sampleRate/2)
+	c.ProcessStereo(ctx, left, right)
+	for i := range left {
+		if math.IsNaN(left[i]) || math.Abs(left[i]) > 2 || math.Abs(right[i]) > 2 {
+			t.Fatalf("sample %d: invalid values %f/%f", i, left[i], right[i])
+		}
+	}
+	if have := maxStep(left); have > 0.2 {
+		t.Errorf("want a smooth sweep, have a step of %f", have)
+	}
+	var diff float64
+	for i := range left {
+		diff += math.Abs(left[i] - right[i])
+	}
+	if diff == 0 {
+		t.Errorf("want different channels for spread voices")
+	}
+
+	// a jump of the delay glides
+	c.Execute(Command{"delay": "40"})
+	ctx.Frame = uint64(len(left))
+	c.ProcessStereo(ctx, left, right)
+	if have := maxStep(left); have > 0.2 {
+		t.Errorf("want a smooth delay change, have a step of %f", have)
+	}
+}
+
+func TestChorusDry(t *testing.T) {
+	c := NewChorus(20, 5, 1, 2)
+	c.Execute(Command{"mix": "0"})
+	c.ConnectInput(ChorusInputSignal, impulse{})
+	buf := make([]float64, 1000)
+	c.Process(&ProcessContext{SampleRate: 44100}, buf)
+	if buf[0] != 1 || rms(buf[1:]) != 0 {
+		t.Errorf("mix 0: want the dry impulse only")
+	}
+}
+
+func TestFlangerNotch(t *testing.T) {
+	const sampleRate = 48000
+	for _, test := range []struct {
+		freq float64
+		want float64
+	}{
+		// a delay of 1 ms cancels 500 Hz and doubles 1000 Hz, mixed half wet
+		{500, 0},
+		{1000, 1},
+	} {
+		f := NewFlanger(1, 0, 0)
+		f.ChangeParameters(FlangerParams{Delay: 1, Mix: 0.5})
+		f.ConnectInput(FlangerInputSignal, NewStdOscillator(StdOscillatorSine, test.freq, 1, 0))
+		buf := make([]float64, sampleRate/10)
+		f.Process(&ProcessContext{SampleRate: sampleRate}, buf)
+		if have := rms(buf[sampleRate/20:]) * math.Sqrt2; math.Abs(have-test.want) > 0.01 {
+			t.Errorf("%d Hz: want ampl %.3f, have %.3f", int(test.freq), test.want, have)
+		}
+	}
+
+	// the sweep with full feedback stays bounded
+	f := NewFlanger(3, 2.5, 0.5)
+	f.Execute(Command{"feedback": "1"})
+	f.ConnectInput(FlangerInputSignal, NewNoise(NoiseWhite, 0.5, 1))
+	buf := make([]float64, 44100)
+	f.Process(&ProcessContext{SampleRate: 44100}, buf)
+	for i, v := range buf {
+		if math.IsNaN(v) || math.Abs(v) > 20 {
+			t.Fatalf("sample %d: invalid value %f", i, v)
+		}
+	}
+}
+
+func TestPhaserNotch(t *testing.T) {
+	const sampleRate = 48000
+	for _, test := range []struct {
+		freq float64
+		want float64
+	}{
+		// two stages shift the center by 180 degrees
+		{1000, 0},
+		{50, 1},
+	} {
+		p := NewPhaser(1000, 0, 0, 2)
+		p.ChangeParameters(PhaserParams{Freq: 1000, Stages: 2, Mix: 0.5})
+		p.ConnectInput(PhaserInputSignal, NewStdOscillator(StdOscillatorSine, test.freq, 1, 0))
+		buf := make([]float64, sampleRate)
+		p.Process(&ProcessContext{SampleRate: sampleRate}, buf)
+		if have := rms(buf[sampleRate/2:]) * math.Sqrt2; math.Abs(have-test.want) > 0.02 {
+			t.Errorf("%d Hz: want ampl %.3f, have %.3f", int(test.freq), test.want, have)
+		}
+	}
+}
+
+func TestPhaserStages(t *testing.T) {
+	for stages, want := range map[int]int{0: 2, 1: 2, 2: 2, 3: 2, 7: 6, 12: 12, 13: 12} {
+		p := NewPhaser(1000, 1, 0.5, stages)
+		if have := p.Parameters().Stages; have != want {
+			t.Errorf("new phaser of %d stages: want %d, have %d", stages, want, have)
+		}
+		p.ChangeParameters(PhaserParams{Freq: 1000, Stages: stages})
+		if have := p.Parameters().Stages; have != want {
+			t.Errorf("change to %d stages: want %d, have %d", stages, want, have)
+		}
+	}
+}
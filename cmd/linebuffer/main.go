@@ -7,9 +7,9 @@ import (
 )
 
 func main() {
-	b := wavx.NewLinearBuffer(5)
+	d := wavx.NewDelayLine(5)
 	for i := 0; i < 20; i++ {
-		b.Push(float64(i))
-		fmt.Println(b.FirstValue())
+		d.Write(float64(i))
+		fmt.Println(d.Tap(5))
 	}
 }
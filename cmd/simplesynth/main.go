@@ -24,9 +24,9 @@ func main() {
 	filter.ConnectInput(wavx.FilterInputSignal, adder)
 
 	reverb := wavx.NewReverb(44100)
-	reverb.ConnectInput(filter)
+	reverb.ConnectInput(wavx.ReverbInputSignal, filter)
 
-	synth := wavx.NewSynthesizer(wavx.SampelRate44100, reverb)
+	synth := wavx.NewSynthesizer(wavx.SampelRate44100, reverb, wavx.NewPortaudioSink())
 	err := synth.Open()
 	if err != nil {
 		log.Errorf("open-synth: %v", err)
@@ -10,7 +10,8 @@ import (
 )
 
 func main() {
-	freqLFO := wavx.NewLFO(wavx.StdOscillatorSine, 0, 10, 3)
+	// the frequency modulation is a deviation in Hz; +-30 Hz at 3 Hz matches the former phase modulation of 10 radians
+	freqLFO := wavx.NewLFO(wavx.StdOscillatorSine, 0, 30, 3)
 	sineModOut := wavx.NewStdOscillator(wavx.StdOscillatorSine, 192, 1.0, 0)
 	sineModOut.ConnectInput(wavx.StdOscillatorInputFreqMod, freqLFO)
 
@@ -33,7 +34,7 @@ func main() {
 	dist.ConnectInput(wavx.DistortionInputSignal, lowPass)
 	dist.ConnectInput(wavx.DistortionInputTresholdModulation, wavx.NewLFO(wavx.StdOscillatorSine, 0, 0.2, 0.5))
 
-	synth := wavx.NewSynthesizer(wavx.SampelRate44100, dist)
+	synth := wavx.NewSynthesizer(wavx.SampelRate44100, dist, wavx.NewPortaudioSink())
 	err := synth.Open()
 	if err != nil {
 		log.Errorf("open-synth: %v", err)
@@ -47,7 +48,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	sigC := make(chan os.Signal)
+	sigC := make(chan os.Signal, 1)
 	signal.Notify(sigC, os.Kill, os.Interrupt)
 	<-sigC
 	synth.Stop()
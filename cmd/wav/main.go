@@ -28,17 +28,14 @@ func main() {
 	// dist.ConnectInput(wavx.DistortionInputSignal, lowPass)
 
 	// reverb := wavx.NewReverb(44100)
-	// reverb.ConnectInput(wo)
-	lfo := wavx.NewLFO(wavx.StdOscillatorSine, 2, 0.5, 50)
-
-	mfin := wavx.NewChorus(44100, 200)
-	mfin.ConnectInput(wo)
-	mfin.ConnectInputLFO(lfo)
+	// reverb.ConnectInput(wavx.ReverbInputSignal, wo)
+	mfin := wavx.NewChorus(2, 0.5, 50, 1)
+	mfin.ConnectInput(wavx.ChorusInputSignal, wo)
 
 	// reverb := wavx.NewReverb(44100)
-	// reverb.ConnectInput(mfin)
+	// reverb.ConnectInput(wavx.ReverbInputSignal, mfin)
 
-	synth := wavx.NewSynthesizer(wavx.SampelRate44100, mfin)
+	synth := wavx.NewSynthesizer(wavx.SampelRate44100, mfin, wavx.NewPortaudioSink())
 	err = synth.Open()
 	handleErr(err)
 
@@ -47,7 +44,7 @@ func main() {
 	err = synth.Start()
 	handleErr(err)
 
-	sigC := make(chan os.Signal)
+	sigC := make(chan os.Signal, 1)
 	signal.Notify(sigC, os.Kill, os.Interrupt)
 	<-sigC
 	synth.Stop()
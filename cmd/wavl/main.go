@@ -3,11 +3,16 @@ package main
 import (
 	"bytes"
 	"context"
+	"flag"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/mazzegi/log"
+	"github.com/mazzegi/log/console"
+	"github.com/mazzegi/wavx"
 	"github.com/mazzegi/wavx/wavl"
+	"github.com/pkg/errors"
 )
 
 func handleErr(err error) {
@@ -20,7 +25,7 @@ func handleErr(err error) {
 
 var commands = `
 add osc osc1 sine 110 1 1
-add osc osc2 saw  220 1 1
+add osc osc2 blsaw 220 1 1
 add mixer mix
 connect osc1 mix:signal
 connect osc2 mix:signal
@@ -45,7 +50,7 @@ set osc1 freq:-10
 `
 
 var commandsOvertones = `
-add osc osc1 saw 110 1 3
+add osc osc1 blsaw 110 1 3
 
 output osc1
 
@@ -67,7 +72,7 @@ set osc1 freq:+40
 `
 
 var commandsKeys = `
-add osc osc1 saw 110 1 1
+add osc osc1 blsaw 110 1 1
 #set osc1 overtones:2
 
 add filter filter1 highpass 0.3 0.5
@@ -85,7 +90,8 @@ sleep 2s
 `
 
 var commandsKeysPool = `
-add oscpool pool
+add oscpool pool 8
+set pool attack:0.02 release:0.8
 
 #add filter filter1 highpass 0.3 0.5
 #connect pool filter1:signal
@@ -102,14 +108,91 @@ sleep 2s
 `
 
 func main() {
-	//buf := bytes.NewBufferString(commandsKeys)
-	buf := bytes.NewBufferString(commandsKeysPool)
+	mode := "play"
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == "play" || args[0] == "render") {
+		mode = args[0]
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("wavl "+mode, flag.ExitOnError)
+	out := fs.String("o", "out.wav", "render, play to wav: output wav file")
+	dur := fs.Duration("d", 10*time.Second, "render: duration")
+	format := fs.String("format", string(wavx.WavFormatPCM16), "sample format (pcm16, float32) for wav and raw output")
+	sinkName := fs.String("sink", "portaudio", "play: audio sink (portaudio, wav, raw, null)")
+	realtime := fs.Bool("realtime", true, "play: pace wav and raw output in realtime")
+	channels := fs.Int("channels", 2, "number of output channels (1, 2)")
+	fs.Parse(args)
+
+	if mode == "play" && *sinkName == "raw" {
+		// stdout belongs to the samples
+		log.Install(log.NewStdLogger("default", console.NewWriter(console.WithStream(os.Stderr))))
+	}
 
-	prj, err := wavl.Parse(buf)
+	var prj *wavl.Project
+	var err error
+	if fs.NArg() > 0 {
+		prj, err = wavl.ParseFile(fs.Arg(0))
+	} else {
+		//buf := bytes.NewBufferString(commandsKeys)
+		buf := bytes.NewBufferString(commandsKeysPool)
+		prj, err = wavl.Parse(buf)
+	}
 	handleErr(err)
+	handleErr(prj.SetChannels(*channels))
+
+	switch mode {
+	case "render":
+		render(prj, *out, *dur, wavx.WavSampleFormat(*format))
+	default:
+		sink, err := newSink(*sinkName, *out, wavx.WavSampleFormat(*format), *realtime)
+		handleErr(err)
+		play(prj, sink)
+	}
+}
+
+func newSink(name string, out string, format wavx.WavSampleFormat, realtime bool) (wavx.AudioSink, error) {
+	switch name {
+	case "portaudio":
+		return wavx.NewPortaudioSink(), nil
+	case "wav":
+		sink := wavx.NewWavFileSink(out, format)
+		sink.Realtime = realtime
+		return sink, nil
+	case "raw":
+		sink := wavx.NewWriterSink(os.Stdout, format)
+		sink.Realtime = realtime
+		return sink, nil
+	case "null":
+		return wavx.NewNullSink(), nil
+	default:
+		return nil, errors.Errorf("unknown sink %q", name)
+	}
+}
 
-	prj.Start()
+func render(prj *wavl.Project, out string, dur time.Duration, format wavx.WavSampleFormat) {
+	f, err := os.Create(out)
+	handleErr(err)
+
+	err = prj.RenderFormat(f, dur, format)
+	if err != nil {
+		f.Close()
+		handleErr(err)
+	}
+	err = f.Close()
+	handleErr(err)
+	log.Infof("rendered %s to %q", dur, out)
+}
+
+func play(prj *wavl.Project, sink wavx.AudioSink) {
+	err := prj.StartWith(sink)
+	handleErr(err)
 	defer prj.Stop()
+	if ns, ok := sink.(*wavx.NullSink); ok {
+		defer func() {
+			log.Infof("rendered %d frames in %s (%.1fx realtime)", ns.Frames(), ns.RenderTime(), ns.RealtimeFactor())
+		}()
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Kill, os.Interrupt)
 	defer cancel()
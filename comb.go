@@ -1,28 +1,49 @@
 package wavx
 
+// CombFilter is a feedback comb filter. Damping in [0, 1) lowpasses the feedback path, so the high frequencies decay faster.
 type CombFilter struct {
 	Gain         float64
+	Damping      float64
 	DelayMsec    float64
 	SamplingRate float64
-	buffer       *LinearBuffer
+	line         *DelayLine
+	delay        int
+	damp         float64
 }
 
 func NewCombFilter(gain, delayMsec, samplingRate float64) *CombFilter {
-	delSamples := int(samplingRate / 1000.0 * delayMsec)
+	delSamples := delaySamples(delayMsec, samplingRate)
 	return &CombFilter{
 		Gain:         gain,
 		DelayMsec:    delayMsec,
 		SamplingRate: samplingRate,
-		buffer:       NewLinearBuffer(delSamples),
+		line:         NewDelayLine(delSamples),
+		delay:        delSamples,
 	}
 }
 
+// delaySamples returns the delay in samples, at least one
+func delaySamples(delayMsec, samplingRate float64) int {
+	n := int(samplingRate / 1000.0 * delayMsec)
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// Change changes the delay; the line only grows, so the delayed signal is kept
 func (f *CombFilter) Change(delayMsec, samplingRate float64) {
-	f.buffer.ChangeMaxSize(int(samplingRate / 1000.0 * delayMsec))
+	f.DelayMsec = delayMsec
+	f.SamplingRate = samplingRate
+	f.delay = delaySamples(delayMsec, samplingRate)
+	if f.delay > f.line.Size() {
+		f.line.Resize(f.delay)
+	}
 }
 
 func (f *CombFilter) Next(x float64) float64 {
-	y := x + f.Gain*f.buffer.FirstValue()
-	f.buffer.Push(y)
+	f.damp = (1-f.Damping)*f.line.Tap(f.delay) + f.Damping*f.damp
+	y := x + f.Gain*f.damp
+	f.line.Write(y)
 	return y
 }
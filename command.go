@@ -101,6 +101,33 @@ func ParseChangeInt(s string) (ChangeInt, error) {
 	}, nil
 }
 
+// SplitIndexedCommand splits the keys of the form <prefix><n>.<key> (e.g. op2.ratio) from cmd.
+// It returns the remaining command and the commands for each index n.
+func SplitIndexedCommand(cmd Command, prefix string) (Command, map[int]Command, error) {
+	rest := Command{}
+	indexed := map[int]Command{}
+	for k, v := range cmd {
+		if !strings.HasPrefix(k, prefix) {
+			rest[k] = v
+			continue
+		}
+		sl := strings.SplitN(strings.TrimPrefix(k, prefix), ".", 2)
+		if len(sl) != 2 {
+			rest[k] = v
+			continue
+		}
+		n, err := strconv.Atoi(sl[0])
+		if err != nil {
+			return nil, nil, errors.Errorf("invalid index in %q", k)
+		}
+		if _, ok := indexed[n]; !ok {
+			indexed[n] = Command{}
+		}
+		indexed[n][sl[1]] = v
+	}
+	return rest, indexed, nil
+}
+
 func ApplyCommand(cmd Command, data interface{}) error {
 	rv := reflect.ValueOf(data)
 	if rv.Kind() != reflect.Ptr {
@@ -0,0 +1,16 @@
+package wavx
+
+import "testing"
+
+func TestSplitIndexedCommand(t *testing.T) {
+	rest, indexed, err := SplitIndexedCommand(Command{"freq": "440", "op2.ratio": "2", "op2.level": "0.5", "op10.level": "1"}, "op")
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	if len(rest) != 1 || rest["freq"] != "440" {
+		t.Errorf("unexpected rest %v", rest)
+	}
+	if len(indexed) != 2 || indexed[2]["ratio"] != "2" || indexed[2]["level"] != "0.5" || indexed[10]["level"] != "1" {
+		t.Errorf("unexpected indexed commands %v", indexed)
+	}
+}
@@ -0,0 +1,282 @@
+package wavx
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mazzegi/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	DelayInputSignal = "signal"
+	// DelayInputTimeModulation is added to the delay time in ms
+	DelayInputTimeModulation = "time-modulation"
+)
+
+const (
+	// maxDelaySecs is the longest delay time
+	maxDelaySecs = 4.0
+	// maxDelayFeedback keeps the feedback loop below unity gain
+	maxDelayFeedback = 0.99
+	// delayGlide smooths changes of the delay time per sample, so they don't click
+	delayGlide = 0.001
+	// maxDelayDamping keeps the damping lowpass open at full damping, so the repeats still sound
+	maxDelayDamping = 0.95
+)
+
+// DelayParams holds the delay params. Time is in ms; if Division is set (e.g. 1/8, 1/8d for dotted, 1/8t for triplets),
+// the time follows Tempo in bpm instead. Feedback and Mix range from 0 to 1, Damping from 0 (bright) to 1 (dark).
+// In PingPong mode the repeats alternate between the left and the right channel.
+type DelayParams struct {
+	Time     float64
+	Division string
+	Tempo    float64
+	Feedback float64
+	Damping  float64
+	Mix      float64
+	PingPong bool
+}
+
+// ParseNoteDivision returns the length of a note division in beats (quarter notes). A division is a fraction
+// of a whole note like 1/4 or 3/16, optionally followed by d (dotted) or t (triplet).
+func ParseNoteDivision(s string) (float64, error) {
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(s, "d"):
+		mult = 1.5
+		s = strings.TrimSuffix(s, "d")
+	case strings.HasSuffix(s, "t"):
+		mult = 2.0 / 3.0
+		s = strings.TrimSuffix(s, "t")
+	}
+	sl := strings.Split(s, "/")
+	if len(sl) != 2 {
+		return 0, errors.Errorf("invalid division %q", s)
+	}
+	num, err := strconv.ParseFloat(sl[0], 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid division %q", s)
+	}
+	den, err := strconv.ParseFloat(sl[1], 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid division %q", s)
+	}
+	if num <= 0 || den <= 0 {
+		return 0, errors.Errorf("invalid division %q", s)
+	}
+	return 4 * num / den * mult, nil
+}
+
+func (p DelayParams) validate() error {
+	if p.Division == "" {
+		return nil
+	}
+	if _, err := ParseNoteDivision(p.Division); err != nil {
+		return err
+	}
+	if p.Tempo <= 0 {
+		return errors.Errorf("invalid tempo %f", p.Tempo)
+	}
+	return nil
+}
+
+// DelaySecs returns the delay time in seconds
+func (p DelayParams) DelaySecs() float64 {
+	if p.Division != "" {
+		beats, err := ParseNoteDivision(p.Division)
+		if err == nil && p.Tempo > 0 {
+			return beats * 60 / p.Tempo
+		}
+	}
+	return p.Time / 1000
+}
+
+type delayChannel struct {
+	line *DelayLine
+	damp float64
+}
+
+// Delay is a stereo delay with a damping lowpass in the feedback path. The per-sample Output assumes SampelRate44100,
+// unless the sample rate is set by SetSampleRate or by a previous Process.
+type Delay struct {
+	mx           sync.RWMutex
+	Params       DelayParams
+	inputSignal  Outputter
+	inputTimeMod Outputter
+	timeModBuf   []float64
+	sampleRate   int
+	left, right  delayChannel
+	delay        float64
+	outL, outR   []float64
+	Activator
+}
+
+func NewDelay(params DelayParams) (*Delay, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	return &Delay{
+		Params:     params,
+		sampleRate: SampelRate44100,
+		delay:      -1,
+	}, nil
+}
+
+func (d *Delay) Inputs() []string {
+	return []string{
+		DelayInputSignal,
+		DelayInputTimeModulation,
+	}
+}
+
+func (d *Delay) ConnectInput(input string, op Outputter) {
+	switch input {
+	case DelayInputSignal:
+		d.inputSignal = op
+	case DelayInputTimeModulation:
+		d.inputTimeMod = op
+	default:
+		log.Warnf("no such input %q", input)
+	}
+}
+
+func (d *Delay) Execute(cmd Command) {
+	params := d.Parameters()
+	err := ApplyCommand(cmd, &params)
+	if err != nil {
+		log.Warnf("apply-command: %v", err)
+		return
+	}
+	err = d.ChangeParameters(params)
+	if err != nil {
+		log.Warnf("delay: %v", err)
+	}
+}
+
+func (d *Delay) Parameters() DelayParams {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+	return d.Params
+}
+
+func (d *Delay) ChangeParameters(params DelayParams) error {
+	if err := params.validate(); err != nil {
+		return err
+	}
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	d.Params = params
+	return nil
+}
+
+func (d *Delay) SetSampleRate(sampleRate int) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	d.setSampleRate(sampleRate)
+}
+
+// setSampleRate reallocates the buffers, if the sample rate changes; mx must be locked
+func (d *Delay) setSampleRate(sampleRate int) {
+	if sampleRate == d.sampleRate && d.left.line != nil {
+		return
+	}
+	d.sampleRate = sampleRate
+	size := int(maxDelaySecs*float64(sampleRate)) + 2
+	d.left = delayChannel{line: NewDelayLine(size)}
+	d.right = delayChannel{line: NewDelayLine(size)}
+	d.delay = -1
+}
+
+func (d *Delay) Output(secs float64) float64 {
+	l, r := d.OutputStereo(secs)
+	return (l + r) / 2
+}
+
+func (d *Delay) OutputStereo(secs float64) (left, right float64) {
+	if d.inputSignal == nil {
+		return 0, 0
+	}
+	l, r := OutputStereo(d.inputSignal, secs)
+	if !d.IsActive() {
+		return l, r
+	}
+	var timeMod float64
+	if d.inputTimeMod != nil {
+		timeMod = d.inputTimeMod.Output(secs)
+	}
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	d.setSampleRate(d.sampleRate)
+	return d.next(l, r, d.Params, d.Params.DelaySecs(), timeMod)
+}
+
+func (d *Delay) Process(ctx *ProcessContext, out []float64) {
+	d.outL = growBuffer(d.outL, len(out))
+	d.outR = growBuffer(d.outR, len(out))
+	d.ProcessStereo(ctx, d.outL, d.outR)
+	midBuffer(out, d.outL, d.outR)
+}
+
+func (d *Delay) ProcessStereo(ctx *ProcessContext, left, right []float64) {
+	if d.inputSignal == nil {
+		zeroBuffer(left)
+		zeroBuffer(right)
+		return
+	}
+	ProcessStereoBlock(ctx, d.inputSignal, left, right)
+	if !d.IsActive() {
+		return
+	}
+	var timeMod []float64
+	if d.inputTimeMod != nil {
+		d.timeModBuf = growBuffer(d.timeModBuf, len(left))
+		timeMod = d.timeModBuf
+		ProcessBlock(ctx, d.inputTimeMod, timeMod)
+	}
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	d.setSampleRate(ctx.SampleRate)
+	params := d.Params
+	delaySecs := params.DelaySecs()
+	for i := range left {
+		var tm float64
+		if timeMod != nil {
+			tm = timeMod[i]
+		}
+		left[i], right[i] = d.next(left[i], right[i], params, delaySecs, tm)
+	}
+}
+
+// next computes the next stereo sample; mx must be locked
+func (d *Delay) next(l, r float64, params DelayParams, delaySecs float64, timeMod float64) (float64, float64) {
+	maxDelay := float64(d.left.line.Size() - 1)
+	target := (delaySecs + timeMod/1000) * float64(d.sampleRate)
+	target = math.Max(1, math.Min(target, maxDelay))
+	if d.delay < 0 {
+		d.delay = target
+	} else {
+		d.delay += delayGlide * (target - d.delay)
+	}
+
+	fb := math.Max(0, math.Min(params.Feedback, maxDelayFeedback))
+	damp := 1 - maxDelayDamping*math.Max(0, math.Min(params.Damping, 1))
+	wetL := d.left.line.TapLinear(d.delay)
+	wetR := d.right.line.TapLinear(d.delay)
+	// one pole lowpass in the feedback path
+	d.left.damp += damp * (wetL - d.left.damp)
+	d.right.damp += damp * (wetR - d.right.damp)
+	if params.PingPong {
+		// the input enters on the left, each repeat crosses over to the other channel
+		d.left.line.Write((l+r)/2 + fb*d.right.damp)
+		d.right.line.Write(fb * d.left.damp)
+	} else {
+		d.left.line.Write(l + fb*d.left.damp)
+		d.right.line.Write(r + fb*d.right.damp)
+	}
+
+	mix := math.Max(0, math.Min(params.Mix, 1))
+	return (1-mix)*l + mix*wetL, (1-mix)*r + mix*wetR
+}
@@ -0,0 +1,141 @@
+package wavx
+
+import (
+	"math"
+	"testing"
+)
+
+// impulse outputs 1 at the first sample and 0 afterwards
+type impulse struct{}
+
+func (impulse) Output(secs float64) float64 {
+	if secs == 0 {
+		return 1
+	}
+	return 0
+}
+
+func TestParseNoteDivision(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		fail bool
+	}{
+		{in: "1/4", want: 1},
+		{in: "1/8", want: 0.5},
+		{in: "3/16", want: 0.75},
+		{in: "1/8d", want: 0.75},
+		{in: "1/4t", want: 2.0 / 3.0},
+		{in: "1/1", want: 4},
+		{in: "4", fail: true},
+		{in: "1/0", fail: true},
+		{in: "x/4", fail: true},
+	}
+	for _, test := range tests {
+		have, err := ParseNoteDivision(test.in)
+		if test.fail {
+			if err == nil {
+				t.Errorf("%q: want error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.in, err)
+			continue
+		}
+		if math.Abs(have-test.want) > 1e-9 {
+			t.Errorf("%q: want %f, have %f", test.in, test.want, have)
+		}
+	}
+
+	params := DelayParams{Time: 250, Division: "1/8d", Tempo: 120}
+	if have := params.DelaySecs(); math.Abs(have-0.375) > 1e-9 {
+		t.Errorf("1/8d at 120 bpm: want 0.375 secs, have %f", have)
+	}
+	params.Division = ""
+	if have := params.DelaySecs(); have != 0.25 {
+		t.Errorf("250 ms: want 0.25 secs, have %f", have)
+	}
+	if _, err := NewDelay(DelayParams{Division: "1/4"}); err == nil {
+		t.Errorf("division without tempo: want error")
+	}
+}
+
+func TestDelayFeedback(t *testing.T) {
+	const sampleRate = 1000
+	d, err := NewDelay(DelayParams{Time: 10, Feedback: 0.5, Mix: 1})
+	if err != nil {
+		t.Fatalf("new-delay: %v", err)
+	}
+	d.ConnectInput(DelayInputSignal, impulse{})
+	buf := make([]float64, 50)
+	d.Process(&ProcessContext{SampleRate: sampleRate}, buf)
+	want := map[int]float64{10: 1, 20: 0.5, 30: 0.25, 40: 0.125}
+	for i, v := range buf {
+		if math.Abs(v-want[i]) > 1e-9 {
+			t.Errorf("sample %d: want %f, have %f", i, want[i], v)
+		}
+	}
+
+	// the damping filter darkens and attenuates the repeats
+	d, _ = NewDelay(DelayParams{Time: 10, Feedback: 0.5, Damping: 0.5, Mix: 1})
+	d.ConnectInput(DelayInputSignal, impulse{})
+	d.Process(&ProcessContext{SampleRate: sampleRate}, buf)
+	if buf[10] != 1 {
+		t.Errorf("damped: want first repeat 1, have %f", buf[10])
+	}
+	if buf[20] >= 0.5 || buf[20] <= 0 {
+		t.Errorf("damped: want second repeat in (0, 0.5), have %f", buf[20])
+	}
+
+	// full damping still gives decaying repeats
+	d, _ = NewDelay(DelayParams{Time: 10, Feedback: 0.9, Damping: 1, Mix: 1})
+	d.ConnectInput(DelayInputSignal, impulse{})
+	buf = make([]float64, 60)
+	d.Process(&ProcessContext{SampleRate: sampleRate}, buf)
+	prev := math.Inf(1)
+	for repeat := 2; repeat <= 5; repeat++ {
+		var sum float64
+		for _, v := range buf[10*repeat : 10*repeat+10] {
+			sum += v
+		}
+		if sum <= 0 || sum >= prev {
+			t.Errorf("full damping, repeat %d: want a level in (0, %f), have %f", repeat, prev, sum)
+		}
+		prev = sum
+	}
+}
+
+func TestDelayMix(t *testing.T) {
+	d, _ := NewDelay(DelayParams{Time: 10, Mix: 0.25})
+	d.SetSampleRate(1000)
+	d.ConnectInput(DelayInputSignal, impulse{})
+	for i := 0; i < 20; i++ {
+		want := 0.0
+		switch i {
+		case 0:
+			want = 0.75
+		case 10:
+			want = 0.25
+		}
+		if have := d.Output(float64(i) / 1000); math.Abs(have-want) > 1e-9 {
+			t.Errorf("sample %d: want %f, have %f", i, want, have)
+		}
+	}
+}
+
+func TestDelayPingPong(t *testing.T) {
+	const sampleRate = 1000
+	d, _ := NewDelay(DelayParams{Time: 10, Feedback: 0.5, Mix: 1, PingPong: true})
+	d.ConnectInput(DelayInputSignal, impulse{})
+	left := make([]float64, 50)
+	right := make([]float64, 50)
+	d.ProcessStereo(&ProcessContext{SampleRate: sampleRate}, left, right)
+	wantL := map[int]float64{10: 1, 30: 0.25}
+	wantR := map[int]float64{20: 0.5, 40: 0.125}
+	for i := range left {
+		if math.Abs(left[i]-wantL[i]) > 1e-9 || math.Abs(right[i]-wantR[i]) > 1e-9 {
+			t.Errorf("sample %d: want %f/%f, have %f/%f", i, wantL[i], wantR[i], left[i], right[i])
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package wavx
+
+import "math"
+
+type DelayInterpolation string
+
+const (
+	// DelayInterpolationNone rounds to the nearest sample
+	DelayInterpolationNone   DelayInterpolation = "none"
+	DelayInterpolationLinear DelayInterpolation = "linear"
+	// DelayInterpolationCubic uses a 4-point hermite spline, which keeps more of the high frequencies than linear
+	DelayInterpolationCubic DelayInterpolation = "cubic"
+	// DelayInterpolationAllPass is flat in magnitude, but should only be swept slowly, as it has state
+	DelayInterpolationAllPass DelayInterpolation = "allpass"
+)
+
+// DelayLine is a preallocated circular buffer. Reading and writing don't allocate, so it may be used in the audio callback.
+// A delay of n reads the value, which was written n writes before the next write; so reading a delay of n
+// before writing the current value delays the signal by n samples. Delays range from 1 to Size.
+type DelayLine struct {
+	data []float64
+	pos  int
+}
+
+func NewDelayLine(size int) *DelayLine {
+	if size < 1 {
+		size = 1
+	}
+	return &DelayLine{
+		data: make([]float64, size),
+	}
+}
+
+// Size returns the longest delay in samples
+func (d *DelayLine) Size() int {
+	return len(d.data)
+}
+
+func (d *DelayLine) Write(v float64) {
+	d.data[d.pos] = v
+	d.pos++
+	if d.pos >= len(d.data) {
+		d.pos = 0
+	}
+}
+
+// Tap returns the value at an integer delay; the delay is clamped to [1, Size]
+func (d *DelayLine) Tap(delay int) float64 {
+	if delay < 1 {
+		delay = 1
+	} else if delay > len(d.data) {
+		delay = len(d.data)
+	}
+	idx := d.pos - delay
+	if idx < 0 {
+		idx += len(d.data)
+	}
+	return d.data[idx]
+}
+
+// TapLinear interpolates linearly between the adjacent samples of a fractional delay
+func (d *DelayLine) TapLinear(delay float64) float64 {
+	i, frac := d.split(delay)
+	v0 := d.Tap(i)
+	if frac == 0 {
+		return v0
+	}
+	return v0 + frac*(d.Tap(i+1)-v0)
+}
+
+// TapCubic interpolates a fractional delay with a hermite spline through the four surrounding samples
+func (d *DelayLine) TapCubic(delay float64) float64 {
+	i, frac := d.split(delay)
+	if frac == 0 {
+		return d.Tap(i)
+	}
+	y0, y1, y2, y3 := d.Tap(i-1), d.Tap(i), d.Tap(i+1), d.Tap(i+2)
+	c1 := (y2 - y0) / 2
+	c2 := y0 - 2.5*y1 + 2*y2 - y3/2
+	c3 := (y3-y0)/2 + 1.5*(y1-y2)
+	return ((c3*frac+c2)*frac+c1)*frac + y1
+}
+
+// split clamps delay to [1, Size] and splits it into the integer and the fractional part
+func (d *DelayLine) split(delay float64) (int, float64) {
+	delay = math.Max(1, math.Min(delay, float64(len(d.data))))
+	i := int(delay)
+	return i, delay - float64(i)
+}
+
+// Resize changes the size. The latest min(old, new) samples are kept, so the taps continue seamlessly.
+// Resize allocates, so it shouldn't be called for every sample.
+func (d *DelayLine) Resize(size int) {
+	if size < 1 {
+		size = 1
+	}
+	if size == len(d.data) {
+		return
+	}
+	n := len(d.data)
+	if size < n {
+		n = size
+	}
+	data := make([]float64, size)
+	for k := 1; k <= n; k++ {
+		data[n-k] = d.Tap(k)
+	}
+	d.data = data
+	d.pos = n % size
+}
+
+// Reset clears the content
+func (d *DelayLine) Reset() {
+	zeroBuffer(d.data)
+	d.pos = 0
+}
+
+// DelayHead is a read head of a delay line. A line may have any number of heads with their own interpolation.
+type DelayHead struct {
+	line          *DelayLine
+	interpolation DelayInterpolation
+	// apOut is the previous output of the allpass interpolation
+	apOut float64
+}
+
+// NewHead returns a read head with interpolation
+func (d *DelayLine) NewHead(interpolation DelayInterpolation) *DelayHead {
+	return &DelayHead{
+		line:          d,
+		interpolation: interpolation,
+	}
+}
+
+// Read returns the value at delay samples. The allpass interpolation must be read exactly once per sample.
+func (h *DelayHead) Read(delay float64) float64 {
+	switch h.interpolation {
+	case DelayInterpolationNone:
+		return h.line.Tap(int(math.Round(delay)))
+	case DelayInterpolationCubic:
+		return h.line.TapCubic(delay)
+	case DelayInterpolationAllPass:
+		return h.readAllPass(delay)
+	default:
+		return h.line.TapLinear(delay)
+	}
+}
+
+// readAllPass delays the sample at the integer part by the fractional part with a first order allpass
+func (h *DelayHead) readAllPass(delay float64) float64 {
+	i, frac := h.line.split(delay)
+	// the allpass works best for fractions in [0.1, 1.1], so the small ones are taken from the previous sample
+	if frac < 0.1 && i > 1 {
+		i--
+		frac++
+	}
+	if frac == 0 {
+		h.apOut = h.line.Tap(i)
+		return h.apOut
+	}
+	eta := (1 - frac) / (1 + frac)
+	y := eta*h.line.Tap(i) + h.line.Tap(i+1) - eta*h.apOut
+	h.apOut = y
+	return y
+}
@@ -0,0 +1,165 @@
+package wavx
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDelayLineTaps(t *testing.T) {
+	d := NewDelayLine(8)
+	for i := 1; i <= 20; i++ {
+		d.Write(float64(i))
+	}
+	// the latest value is 20
+	for delay := 1; delay <= 8; delay++ {
+		if have, want := d.Tap(delay), float64(21-delay); have != want {
+			t.Errorf("tap %d: want %f, have %f", delay, want, have)
+		}
+	}
+	if have := d.Tap(9); have != 13 {
+		t.Errorf("tap beyond size: want the oldest value 13, have %f", have)
+	}
+
+	// a ramp is interpolated exactly by all fractional taps
+	for _, delay := range []float64{2.5, 3.25, 4.75, 6.1} {
+		want := 21 - delay
+		if have := d.TapLinear(delay); math.Abs(have-want) > 1e-12 {
+			t.Errorf("linear %.2f: want %f, have %f", delay, want, have)
+		}
+		if have := d.TapCubic(delay); math.Abs(have-want) > 1e-12 {
+			t.Errorf("cubic %.2f: want %f, have %f", delay, want, have)
+		}
+	}
+}
+
+func TestDelayLineResize(t *testing.T) {
+	d := NewDelayLine(8)
+	for i := 1; i <= 20; i++ {
+		d.Write(float64(i))
+	}
+	d.Resize(16)
+	for delay := 1; delay <= 8; delay++ {
+		if have, want := d.Tap(delay), float64(21-delay); have != want {
+			t.Errorf("grown, tap %d: want %f, have %f", delay, want, have)
+		}
+	}
+	if have := d.Tap(9); have != 0 {
+		t.Errorf("grown, tap 9: want 0, have %f", have)
+	}
+	d.Write(21)
+	if have := d.Tap(9); have != 13 {
+		t.Errorf("grown, tap 9 after write: want 13, have %f", have)
+	}
+
+	d.Resize(4)
+	for delay := 1; delay <= 4; delay++ {
+		if have, want := d.Tap(delay), float64(22-delay); have != want {
+			t.Errorf("shrunk, tap %d: want %f, have %f", delay, want, have)
+		}
+	}
+	d.Write(22)
+	if have := d.Tap(4); have != 19 {
+		t.Errorf("shrunk, tap 4 after write: want 19, have %f", have)
+	}
+}
+
+func TestDelayHeads(t *testing.T) {
+	const sampleRate = 48000
+	const delay = 10.3
+	for _, interp := range []DelayInterpolation{DelayInterpolationNone, DelayInterpolationLinear, DelayInterpolationCubic, DelayInterpolationAllPass} {
+		d := NewDelayLine(64)
+		head := d.NewHead(interp)
+		osc := NewStdOscillator(StdOscillatorSine, 1000, 1, 0)
+		n := sampleRate / 10
+		in := make([]float64, n)
+		out := make([]float64, n)
+		ProcessBlock(&ProcessContext{SampleRate: sampleRate}, osc, in)
+		for i, v := range in {
+			out[i] = head.Read(delay)
+			d.Write(v)
+		}
+		want := delay
+		if interp == DelayInterpolationNone {
+			want = math.Round(delay)
+		}
+		// compare with the analytic sine, skipping the transient
+		var maxErr float64
+		for i := n / 2; i < n; i++ {
+			expect := math.Sin(2 * math.Pi * 1000 * (float64(i) - want) / sampleRate)
+			maxErr = math.Max(maxErr, math.Abs(out[i]-expect))
+		}
+		if maxErr > 0.02 {
+			t.Errorf("%s: want delay %.1f, have max error %f", interp, want, maxErr)
+		}
+	}
+}
+
+func TestCombFilterChange(t *testing.T) {
+	// delays below a sample are clamped instead of panicking
+	f := NewCombFilter(0.5, 10, 1000)
+	f.Next(1)
+	f.Change(0.1, 1000)
+	f.Change(-5, 1000)
+	f.Change(20, 1000)
+	for i := 0; i < 100; i++ {
+		if v := f.Next(0); math.IsNaN(v) {
+			t.Fatalf("sample %d is NaN", i)
+		}
+	}
+
+	// the impulse returns after the delay
+	f = NewCombFilter(0.5, 10, 1000)
+	want := map[int]float64{0: 1, 10: 0.5, 20: 0.25}
+	for i := 0; i < 30; i++ {
+		var x float64
+		if i == 0 {
+			x = 1
+		}
+		if have := f.Next(x); have != want[i] {
+			t.Errorf("sample %d: want %f, have %f", i, want[i], have)
+		}
+	}
+}
+
+func BenchmarkDelayLine(b *testing.B) {
+	d := NewDelayLine(SampelRate44100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d.Write(float64(i))
+		_ = d.TapCubic(1234.5)
+	}
+}
+
+func BenchmarkCombFilter(b *testing.B) {
+	f := NewCombFilter(0.8, 30, SampelRate44100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f.Next(1)
+	}
+}
+
+func BenchmarkReverb(b *testing.B) {
+	r := NewReverb(SampelRate44100)
+	r.ConnectInput(ReverbInputSignal, NewNoise(NoiseWhite, 0.5, 1))
+	ctx := &ProcessContext{SampleRate: SampelRate44100}
+	left := make([]float64, DefaultFramesPerBuffer)
+	right := make([]float64, DefaultFramesPerBuffer)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.ProcessStereo(ctx, left, right)
+		ctx.Frame += uint64(len(left))
+	}
+}
+
+func BenchmarkChorus(b *testing.B) {
+	c := NewChorus(20, 5, 0.8, 3)
+	c.ConnectInput(ChorusInputSignal, NewNoise(NoiseWhite, 0.5, 1))
+	ctx := &ProcessContext{SampleRate: SampelRate44100}
+	left := make([]float64, DefaultFramesPerBuffer)
+	right := make([]float64, DefaultFramesPerBuffer)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.ProcessStereo(ctx, left, right)
+		ctx.Frame += uint64(len(left))
+	}
+}
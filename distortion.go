@@ -4,10 +4,12 @@ import (
 	"github.com/mazzegi/log"
 )
 
+// Distortion hard clips a signal at the threshold; stereo signals are clipped per channel
 type Distortion struct {
 	baseThreshold     float64
 	inputSignal       Outputter
 	inputThresholdMod Outputter
+	modBuf            []float64
 }
 
 func NewDistortion(baseThreshold float64) *Distortion {
@@ -48,6 +50,63 @@ func (d *Distortion) Output(secs float64) float64 {
 	if d.inputThresholdMod != nil {
 		threshold += d.inputThresholdMod.Output(secs)
 	}
+	return d.clip(newVal, threshold)
+}
+
+func (d *Distortion) carriesStereo() bool {
+	return d.inputSignal != nil && carriesStereo(d.inputSignal)
+}
+
+func (d *Distortion) OutputStereo(secs float64) (left, right float64) {
+	if d.inputSignal == nil {
+		return 0, 0
+	}
+	left, right = OutputStereo(d.inputSignal, secs)
+	threshold := d.baseThreshold
+	if d.inputThresholdMod != nil {
+		threshold += d.inputThresholdMod.Output(secs)
+	}
+	return d.clip(left, threshold), d.clip(right, threshold)
+}
+
+func (d *Distortion) Process(ctx *ProcessContext, out []float64) {
+	if d.inputSignal == nil {
+		zeroBuffer(out)
+		return
+	}
+	ProcessBlock(ctx, d.inputSignal, out)
+	d.clipBlock(ctx, out, nil)
+}
+
+func (d *Distortion) ProcessStereo(ctx *ProcessContext, left, right []float64) {
+	if d.inputSignal == nil {
+		zeroBuffer(left)
+		zeroBuffer(right)
+		return
+	}
+	ProcessStereoBlock(ctx, d.inputSignal, left, right)
+	d.clipBlock(ctx, left, right)
+}
+
+// clipBlock clips the block in place; right is nil for a mono block
+func (d *Distortion) clipBlock(ctx *ProcessContext, left, right []float64) {
+	if d.inputThresholdMod != nil {
+		d.modBuf = growBuffer(d.modBuf, len(left))
+		ProcessBlock(ctx, d.inputThresholdMod, d.modBuf)
+	}
+	for i, v := range left {
+		threshold := d.baseThreshold
+		if d.inputThresholdMod != nil {
+			threshold += d.modBuf[i]
+		}
+		left[i] = d.clip(v, threshold)
+		if right != nil {
+			right[i] = d.clip(right[i], threshold)
+		}
+	}
+}
+
+func (d *Distortion) clip(newVal float64, threshold float64) float64 {
 	if threshold < 0 {
 		threshold = 0
 	} else if threshold > 1 {
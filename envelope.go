@@ -1,24 +1,95 @@
 package wavx
 
-import "math"
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
 
 const envEps = float64(0.0001)
 
-// EnvelopeParams holds all envelope params; attack, decay and release are in seconds
+// EnvelopeCurve is the shape of an envelope stage
+type EnvelopeCurve string
+
+const (
+	EnvelopeCurveLinear EnvelopeCurve = "linear"
+	// EnvelopeCurveExp is concave up: a rising stage starts slowly, a falling stage starts fast (like an RC discharge)
+	EnvelopeCurveExp EnvelopeCurve = "exp"
+	// EnvelopeCurveLog is concave down: a rising stage starts fast (like an RC charge), a falling stage starts slowly
+	EnvelopeCurveLog EnvelopeCurve = "log"
+)
+
+// envCurveK is the steepness of the exp and log curves
+const envCurveK = 5.0
+
+// EnvelopeMode tells what happens, when an active envelope is started again
+type EnvelopeMode string
+
+const (
+	// EnvelopeModeRetrigger restarts the attack from the current level
+	EnvelopeModeRetrigger EnvelopeMode = "retrigger"
+	// EnvelopeModeLegato keeps a held envelope running; a released one restarts the attack from the current level
+	EnvelopeModeLegato EnvelopeMode = "legato"
+)
+
+// EnvelopePoint is a breakpoint at Time seconds after the start; Curve shapes the stage which ends at the point
+type EnvelopePoint struct {
+	Time  float64
+	Level float64
+	Curve EnvelopeCurve
+}
+
+// EnvelopeParams holds all envelope params; delay, attack, hold, decay and release are in seconds.
+// The curves default to linear, the mode to retrigger.
+// If Points are set, they replace the attack, hold, decay and sustain stages: the level moves from point to point
+// and stays at the last one until the release. With LoopEnd > LoopStart the stages between these points repeat
+// until the release; the level jumps back to the point LoopStart.
 type EnvelopeParams struct {
-	Attack  float64
-	Decay   float64
-	Sustain float64
-	Release float64
+	Delay        float64
+	Attack       float64
+	Hold         float64
+	Decay        float64
+	Sustain      float64
+	Release      float64
+	AttackCurve  EnvelopeCurve
+	DecayCurve   EnvelopeCurve
+	ReleaseCurve EnvelopeCurve
+	Mode         EnvelopeMode
+	Points       []EnvelopePoint
+	LoopStart    int
+	LoopEnd      int
+}
+
+func (p EnvelopeParams) validate() error {
+	for i, pt := range p.Points {
+		if pt.Time < 0 || (i > 0 && pt.Time < p.Points[i-1].Time) {
+			return errors.Errorf("point %d: time %f is not ascending", i, pt.Time)
+		}
+	}
+	if p.hasLoop() {
+		if p.LoopStart < 0 || p.LoopEnd >= len(p.Points) {
+			return errors.Errorf("loop %d-%d is out of the %d points", p.LoopStart, p.LoopEnd, len(p.Points))
+		}
+		if p.Points[p.LoopEnd].Time <= p.Points[p.LoopStart].Time {
+			return errors.Errorf("loop %d-%d has no duration", p.LoopStart, p.LoopEnd)
+		}
+	}
+	return nil
+}
+
+func (p EnvelopeParams) hasLoop() bool {
+	return len(p.Points) > 0 && p.LoopEnd > p.LoopStart
 }
 
 type Envelope struct {
-	params     EnvelopeParams
-	isActive   bool
-	startedAt  float64
-	isStarted  bool
-	releasedAt float64
-	isReleased bool
+	params       EnvelopeParams
+	isActive     bool
+	startedAt    float64
+	startLevel   float64
+	isStarted    bool
+	releasedAt   float64
+	releaseLevel float64
+	isReleased   bool
 }
 
 func NewEnvelope(ps EnvelopeParams) *Envelope {
@@ -35,44 +106,118 @@ func (e *Envelope) IsStarted() bool {
 	return e.isStarted
 }
 
+// Start starts the attack at secs. An active envelope continues from its current level, so it doesn't click.
 func (e *Envelope) Start(secs float64) {
+	if e.isActive && !e.isReleased && e.params.Mode == EnvelopeModeLegato {
+		return
+	}
+	var level float64
+	if e.isActive {
+		level = e.Value(secs)
+	}
 	e.startedAt = secs
+	e.startLevel = level
 	e.isStarted = true
 	e.isActive = true
+	e.isReleased = false
 }
 
+// Release starts the release at secs from the current level
 func (e *Envelope) Release(secs float64) {
 	if !e.isActive {
 		return
 	}
+	e.releaseLevel = e.Value(secs)
 	e.releasedAt = secs
 	e.isReleased = true
 }
 
 func (e *Envelope) Value(secs float64) float64 {
+	if !e.isStarted {
+		return 0
+	}
 	if e.isReleased {
 		dur := secs - e.releasedAt
-		v := -e.params.Sustain*dur/e.params.Release + e.params.Sustain
-		if math.Abs(v) < envEps {
+		if dur >= e.params.Release || e.releaseLevel < envEps {
 			e.isActive = false
+			return 0
 		}
-		return v
-	} else if e.isStarted {
-		dur := secs - e.startedAt
-		switch {
-		case dur < e.params.Attack:
-			return dur / e.params.Attack
-		case dur < e.params.Attack+e.params.Decay:
-			return 1.0 - (1.0-e.params.Sustain)*(dur-e.params.Attack)/e.params.Decay
-		default:
-			return e.params.Sustain
+		return envelopeStage(e.releaseLevel, 0, dur/e.params.Release, e.params.ReleaseCurve)
+	}
+
+	dur := secs - e.startedAt
+	if dur < e.params.Delay {
+		return e.startLevel
+	}
+	dur -= e.params.Delay
+	if len(e.params.Points) > 0 {
+		return e.pointsValue(dur)
+	}
+	// the attack keeps its rate, if it starts above 0
+	attack := e.params.Attack * (1 - e.startLevel)
+	if dur < attack {
+		return envelopeStage(e.startLevel, 1, dur/attack, e.params.AttackCurve)
+	}
+	dur -= attack
+	if dur < e.params.Hold {
+		return 1
+	}
+	dur -= e.params.Hold
+	if dur < e.params.Decay {
+		return envelopeStage(1, e.params.Sustain, dur/e.params.Decay, e.params.DecayCurve)
+	}
+	return e.params.Sustain
+}
+
+// pointsValue returns the level dur seconds after the delay. A retriggered envelope starts
+// from its current level instead of the level of the first point.
+func (e *Envelope) pointsValue(dur float64) float64 {
+	pts := e.params.Points
+	looping := false
+	if e.params.hasLoop() {
+		start, end := pts[e.params.LoopStart].Time, pts[e.params.LoopEnd].Time
+		if dur >= end {
+			dur = start + math.Mod(dur-end, end-start)
+			looping = true
 		}
-	} else {
-		return 0
 	}
+	if dur >= pts[len(pts)-1].Time {
+		return pts[len(pts)-1].Level
+	}
+	from := EnvelopePoint{Level: e.startLevel}
+	for i, to := range pts {
+		if dur < to.Time {
+			return envelopeStage(from.Level, to.Level, (dur-from.Time)/(to.Time-from.Time), to.Curve)
+		}
+		if i == 0 && e.startLevel > 0 && !looping {
+			continue
+		}
+		from = to
+	}
+	return from.Level
+}
+
+// envelopeStage returns the level at the progress x in [0, 1] of a stage from level a to b
+func envelopeStage(a, b float64, x float64, curve EnvelopeCurve) float64 {
+	if x <= 0 {
+		return a
+	} else if x >= 1 {
+		return b
+	}
+	// fast covers most of the distance at the beginning, slow at the end
+	fast := func() float64 { return (1 - math.Exp(-envCurveK*x)) / (1 - math.Exp(-envCurveK)) }
+	slow := func() float64 { return (math.Exp(envCurveK*x) - 1) / (math.Exp(envCurveK) - 1) }
+	s := x
+	switch {
+	case curve == EnvelopeCurveExp && b > a, curve == EnvelopeCurveLog && b < a:
+		s = slow()
+	case curve == EnvelopeCurveExp && b < a, curve == EnvelopeCurveLog && b > a:
+		s = fast()
+	}
+	return a + (b-a)*s
 }
 
-//
+// FixedSustainEnvelope releases itself after sustaining for sustainDuration
 type FixedSustainEnvelope struct {
 	*Envelope
 	sustainDuration float64
@@ -92,7 +237,7 @@ func (e *FixedSustainEnvelope) Value(secs float64) float64 {
 	if !e.isReleased {
 		//auto release after sustain duration
 		dur := secs - e.startedAt
-		if dur >= e.params.Attack+e.params.Decay+e.sustainDuration {
+		if dur >= e.params.Delay+e.params.Attack*(1-e.startLevel)+e.params.Hold+e.params.Decay+e.sustainDuration {
 			e.Release(secs)
 		}
 	}
@@ -1,10 +1,17 @@
 package wavx
 
 import (
-	"fmt"
+	"math"
 	"testing"
 )
 
+func assertLevel(t *testing.T, env interface{ Value(float64) float64 }, secs float64, want float64) {
+	t.Helper()
+	if have := env.Value(secs); math.Abs(have-want) > 1e-6 {
+		t.Errorf("%.3f sec: want %f, have %f", secs, want, have)
+	}
+}
+
 func TestEnvelope(t *testing.T) {
 	env := NewFixedSustainEnvelope(
 		EnvelopeParams{
@@ -15,13 +22,131 @@ func TestEnvelope(t *testing.T) {
 		},
 		2.0,
 	)
-	s := float64(0)
-	env.Start(s)
-	for ; s < 10.0; s += 0.1 {
-		fmt.Printf("%.2f sec => %.4f\n", s, env.Value(s))
-		if !env.IsActive() {
-			fmt.Printf("envelope is done\n")
-			break
-		}
+	env.Start(0)
+	assertLevel(t, env, 0, 0)
+	assertLevel(t, env, 0.1, 0.5)
+	assertLevel(t, env, 0.2, 1)
+	assertLevel(t, env, 0.35, 0.85)
+	assertLevel(t, env, 0.5, 0.7)
+	assertLevel(t, env, 2.4, 0.7)
+	// auto release after attack, decay and sustain duration
+	assertLevel(t, env, 2.5, 0.7)
+	assertLevel(t, env, 4.5, 0.35)
+	assertLevel(t, env, 6.5, 0)
+	if env.IsActive() {
+		t.Fatalf("envelope is still active")
+	}
+}
+
+func TestEnvelopeCurves(t *testing.T) {
+	fast := (1 - math.Exp(-envCurveK*0.5)) / (1 - math.Exp(-envCurveK))
+	slow := (math.Exp(envCurveK*0.5) - 1) / (math.Exp(envCurveK) - 1)
+	tests := []struct {
+		curve              EnvelopeCurve
+		attack, decay, rel float64
+	}{
+		{EnvelopeCurveLinear, 0.5, 0.75, 0.25},
+		{EnvelopeCurveExp, slow, 1 - 0.5*fast, 0.5 - 0.5*fast},
+		{EnvelopeCurveLog, fast, 1 - 0.5*slow, 0.5 - 0.5*slow},
+	}
+	for _, test := range tests {
+		t.Run(string(test.curve), func(t *testing.T) {
+			env := NewEnvelope(EnvelopeParams{
+				Attack: 1, Decay: 1, Sustain: 0.5, Release: 1,
+				AttackCurve: test.curve, DecayCurve: test.curve, ReleaseCurve: test.curve,
+			})
+			env.Start(0)
+			assertLevel(t, env, 0.5, test.attack)
+			assertLevel(t, env, 1, 1)
+			assertLevel(t, env, 1.5, test.decay)
+			assertLevel(t, env, 2, 0.5)
+			env.Release(3)
+			assertLevel(t, env, 3.5, test.rel)
+			assertLevel(t, env, 4, 0)
+		})
+	}
+}
+
+func TestEnvelopeReleaseFromCurrentLevel(t *testing.T) {
+	env := NewEnvelope(EnvelopeParams{Attack: 1, Decay: 1, Sustain: 0.8, Release: 1})
+	env.Start(0)
+	env.Release(0.25)
+	// the release starts at the attack level, not at the sustain level
+	assertLevel(t, env, 0.25, 0.25)
+	assertLevel(t, env, 0.75, 0.125)
+	assertLevel(t, env, 1.25, 0)
+}
+
+func TestEnvelopeRetrigger(t *testing.T) {
+	env := NewEnvelope(EnvelopeParams{Attack: 1, Decay: 1, Sustain: 0.5, Release: 1})
+	env.Start(0)
+	env.Release(3)
+	assertLevel(t, env, 3.5, 0.25)
+	// the attack continues from the current level with its rate
+	env.Start(3.5)
+	assertLevel(t, env, 3.5, 0.25)
+	assertLevel(t, env, 4, 0.75)
+	assertLevel(t, env, 4.25, 1)
+}
+
+func TestEnvelopeLegato(t *testing.T) {
+	env := NewEnvelope(EnvelopeParams{Attack: 1, Decay: 1, Sustain: 0.5, Release: 1, Mode: EnvelopeModeLegato})
+	env.Start(0)
+	env.Start(1.5)
+	// a held envelope keeps running
+	assertLevel(t, env, 1.5, 0.75)
+	assertLevel(t, env, 2.5, 0.5)
+	env.Release(3)
+	env.Start(3.5)
+	// a released one restarts
+	assertLevel(t, env, 4, 0.75)
+}
+
+func TestEnvelopeDAHDSR(t *testing.T) {
+	env := NewEnvelope(EnvelopeParams{Delay: 1, Attack: 1, Hold: 1, Decay: 1, Sustain: 0.5, Release: 1})
+	env.Start(0)
+	assertLevel(t, env, 0.5, 0)
+	assertLevel(t, env, 1.5, 0.5)
+	assertLevel(t, env, 2.5, 1)
+	assertLevel(t, env, 3.5, 0.75)
+	assertLevel(t, env, 5, 0.5)
+}
+
+func TestEnvelopePoints(t *testing.T) {
+	params := EnvelopeParams{
+		Points: []EnvelopePoint{
+			{Time: 0, Level: 0},
+			{Time: 0.1, Level: 1},
+			{Time: 0.5, Level: 0.2},
+			{Time: 1, Level: 0.6},
+		},
+		Release: 0.5,
+	}
+	env := NewEnvelope(params)
+	env.Start(0)
+	assertLevel(t, env, 0.05, 0.5)
+	assertLevel(t, env, 0.3, 0.6)
+	assertLevel(t, env, 0.75, 0.4)
+	// the last point sustains
+	assertLevel(t, env, 3, 0.6)
+	env.Release(3)
+	assertLevel(t, env, 3.25, 0.3)
+
+	params.LoopStart, params.LoopEnd = 1, 2
+	if err := params.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	env = NewEnvelope(params)
+	env.Start(0)
+	// the loop from 0.1 to 0.5 repeats every 0.4 seconds
+	for _, secs := range []float64{0.3, 0.7, 1.1, 4.3} {
+		assertLevel(t, env, secs, 0.6)
+	}
+	env.Release(4.3)
+	assertLevel(t, env, 4.55, 0.3)
+
+	params.LoopStart, params.LoopEnd = 2, 5
+	if err := params.validate(); err == nil {
+		t.Fatalf("want error for loop out of range")
 	}
 }
@@ -0,0 +1,339 @@
+package wavx
+
+import (
+	"math"
+	"sync"
+
+	"github.com/mazzegi/log"
+	"github.com/pkg/errors"
+)
+
+type EQBandType string
+
+const (
+	EQLowShelf  EQBandType = "lowshelf"
+	EQHighShelf EQBandType = "highshelf"
+	EQPeak      EQBandType = "peak"
+	// EQLowCut removes the frequencies below Freq (highpass)
+	EQLowCut EQBandType = "lowcut"
+	// EQHighCut removes the frequencies above Freq (lowpass)
+	EQHighCut EQBandType = "highcut"
+)
+
+const (
+	EQInputSignal = "signal"
+)
+
+// EQBand holds the params of a single band; Freq is in Hz, Gain in dB (not used by the cut types)
+type EQBand struct {
+	Type EQBandType
+	Freq float64
+	Gain float64
+	Q    float64
+}
+
+func (b EQBand) validate() error {
+	switch b.Type {
+	case EQLowShelf, EQHighShelf, EQPeak, EQLowCut, EQHighCut:
+	default:
+		return errors.Errorf("invalid band type %q", b.Type)
+	}
+	if b.Freq <= 0 {
+		return errors.Errorf("invalid frequency %f", b.Freq)
+	}
+	if b.Q <= 0 {
+		return errors.Errorf("invalid q %f", b.Q)
+	}
+	return nil
+}
+
+func (b EQBand) biquadType() BiquadType {
+	switch b.Type {
+	case EQLowShelf:
+		return BiquadLowShelf
+	case EQHighShelf:
+		return BiquadHighShelf
+	case EQLowCut:
+		return BiquadHighPass
+	case EQHighCut:
+		return BiquadLowPass
+	default:
+		return BiquadPeaking
+	}
+}
+
+func (b EQBand) coefficients(sampleRate int) BiquadCoefficients {
+	return NewBiquadCoefficients(b.biquadType(), b.Freq, b.Q, b.Gain, sampleRate)
+}
+
+// EQParams holds the eq params; Gain is the output gain in dB
+type EQParams struct {
+	Gain float64
+}
+
+type eqBand struct {
+	band             EQBand
+	states           [2]biquadState
+	coeffs           BiquadCoefficients
+	coeffsSampleRate int
+}
+
+// coefficients returns the coefficients of the band; they are only computed again, if the band or the sample rate change
+func (b *eqBand) coefficients(sampleRate int) *BiquadCoefficients {
+	if sampleRate != b.coeffsSampleRate {
+		b.coeffs = b.band.coefficients(sampleRate)
+		b.coeffsSampleRate = sampleRate
+	}
+	return &b.coeffs
+}
+
+// EQ is a parametric equalizer of biquad bands in series; stereo signals are filtered per channel.
+// The per-sample Output assumes SampelRate44100, unless the sample rate is set by SetSampleRate or by a previous Process.
+type EQ struct {
+	mx          sync.RWMutex
+	Params      EQParams
+	bands       []*eqBand
+	inputSignal Outputter
+	sampleRate  int
+	Activator
+}
+
+func NewEQ(bands ...EQBand) (*EQ, error) {
+	eq := &EQ{
+		sampleRate: SampelRate44100,
+	}
+	for i, b := range bands {
+		if err := b.validate(); err != nil {
+			return nil, errors.Wrapf(err, "band %d", i+1)
+		}
+		eq.bands = append(eq.bands, &eqBand{band: b})
+	}
+	return eq, nil
+}
+
+func (eq *EQ) Inputs() []string {
+	return []string{
+		EQInputSignal,
+	}
+}
+
+func (eq *EQ) ConnectInput(input string, op Outputter) {
+	switch input {
+	case EQInputSignal:
+		eq.inputSignal = op
+	default:
+		log.Warnf("no such input %q", input)
+	}
+}
+
+// Execute changes the eq params (e.g. gain:-3) and the band params (e.g. band2.gain:+3, band1.freq:120)
+func (eq *EQ) Execute(cmd Command) {
+	rest, bandCmds, err := SplitIndexedCommand(cmd, "band")
+	if err != nil {
+		log.Warnf("eq: %v", err)
+		return
+	}
+	for n, bandCmd := range bandCmds {
+		err := eq.ChangeBand(n, bandCmd)
+		if err != nil {
+			log.Warnf("eq: %v", err)
+			return
+		}
+	}
+	if len(rest) == 0 {
+		return
+	}
+	params := eq.Parameters()
+	err = ApplyCommand(rest, &params)
+	if err != nil {
+		log.Warnf("apply-command: %v", err)
+		return
+	}
+	eq.ChangeParameters(params)
+}
+
+func (eq *EQ) Parameters() EQParams {
+	eq.mx.RLock()
+	defer eq.mx.RUnlock()
+	return eq.Params
+}
+
+func (eq *EQ) ChangeParameters(params EQParams) {
+	eq.mx.Lock()
+	defer eq.mx.Unlock()
+	eq.Params = params
+}
+
+func (eq *EQ) SetSampleRate(sampleRate int) {
+	eq.mx.Lock()
+	defer eq.mx.Unlock()
+	eq.sampleRate = sampleRate
+}
+
+// Bands returns the params of all bands
+func (eq *EQ) Bands() []EQBand {
+	eq.mx.RLock()
+	defer eq.mx.RUnlock()
+	bands := make([]EQBand, len(eq.bands))
+	for i, b := range eq.bands {
+		bands[i] = b.band
+	}
+	return bands
+}
+
+// Band returns the params of band n (1-based)
+func (eq *EQ) Band(n int) (EQBand, error) {
+	eq.mx.RLock()
+	defer eq.mx.RUnlock()
+	if n < 1 || n > len(eq.bands) {
+		return EQBand{}, errors.Errorf("no such band %d", n)
+	}
+	return eq.bands[n-1].band, nil
+}
+
+// SetBand replaces the params of band n (1-based). The filter state is kept, so the change doesn't click.
+func (eq *EQ) SetBand(n int, band EQBand) error {
+	eq.mx.Lock()
+	defer eq.mx.Unlock()
+	return eq.setBand(n, band)
+}
+
+// ChangeBand applies cmd to the params of band n (1-based)
+func (eq *EQ) ChangeBand(n int, cmd Command) error {
+	eq.mx.Lock()
+	defer eq.mx.Unlock()
+	if n < 1 || n > len(eq.bands) {
+		return errors.Errorf("no such band %d", n)
+	}
+	band := eq.bands[n-1].band
+	err := ApplyCommand(cmd, &band)
+	if err != nil {
+		return errors.Wrapf(err, "band %d", n)
+	}
+	return eq.setBand(n, band)
+}
+
+// setBand sets the params of band n; mx must be locked
+func (eq *EQ) setBand(n int, band EQBand) error {
+	if n < 1 || n > len(eq.bands) {
+		return errors.Errorf("no such band %d", n)
+	}
+	if err := band.validate(); err != nil {
+		return errors.Wrapf(err, "band %d", n)
+	}
+	b := eq.bands[n-1]
+	b.band = band
+	b.coeffsSampleRate = 0
+	return nil
+}
+
+// AddBand appends a band and returns its number
+func (eq *EQ) AddBand(band EQBand) (int, error) {
+	if err := band.validate(); err != nil {
+		return 0, err
+	}
+	eq.mx.Lock()
+	defer eq.mx.Unlock()
+	eq.bands = append(eq.bands, &eqBand{band: band})
+	return len(eq.bands), nil
+}
+
+// MagnitudeResponse returns the combined gain of all bands and the output gain at each of freqs
+func (eq *EQ) MagnitudeResponse(freqs []float64, sampleRate int) []float64 {
+	eq.mx.RLock()
+	defer eq.mx.RUnlock()
+	coeffs := make([]BiquadCoefficients, len(eq.bands))
+	for i, b := range eq.bands {
+		coeffs[i] = b.band.coefficients(sampleRate)
+	}
+	gain := dBToGain(eq.Params.Gain)
+	mags := make([]float64, len(freqs))
+	for i, freq := range freqs {
+		m := gain
+		for _, c := range coeffs {
+			m *= c.Magnitude(freq, sampleRate)
+		}
+		mags[i] = m
+	}
+	return mags
+}
+
+func dBToGain(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+func (eq *EQ) carriesStereo() bool {
+	return eq.inputSignal != nil && carriesStereo(eq.inputSignal)
+}
+
+func (eq *EQ) Output(secs float64) float64 {
+	if eq.inputSignal == nil {
+		return 0
+	}
+	v := eq.inputSignal.Output(secs)
+	if !eq.IsActive() {
+		return v
+	}
+	eq.mx.Lock()
+	defer eq.mx.Unlock()
+	return eq.next(0, v, dBToGain(eq.Params.Gain), eq.sampleRate)
+}
+
+func (eq *EQ) OutputStereo(secs float64) (left, right float64) {
+	if !eq.carriesStereo() {
+		v := eq.Output(secs)
+		return v, v
+	}
+	left, right = OutputStereo(eq.inputSignal, secs)
+	if !eq.IsActive() {
+		return left, right
+	}
+	eq.mx.Lock()
+	defer eq.mx.Unlock()
+	gain := dBToGain(eq.Params.Gain)
+	return eq.next(0, left, gain, eq.sampleRate), eq.next(1, right, gain, eq.sampleRate)
+}
+
+func (eq *EQ) Process(ctx *ProcessContext, out []float64) {
+	if eq.inputSignal == nil {
+		zeroBuffer(out)
+		return
+	}
+	ProcessBlock(ctx, eq.inputSignal, out)
+	eq.filter(ctx, out, nil)
+}
+
+func (eq *EQ) ProcessStereo(ctx *ProcessContext, left, right []float64) {
+	if !eq.carriesStereo() {
+		eq.Process(ctx, left)
+		copy(right, left)
+		return
+	}
+	ProcessStereoBlock(ctx, eq.inputSignal, left, right)
+	eq.filter(ctx, left, right)
+}
+
+// filter filters the block in place; right is nil for a mono block
+func (eq *EQ) filter(ctx *ProcessContext, left, right []float64) {
+	if !eq.IsActive() {
+		return
+	}
+	eq.mx.Lock()
+	defer eq.mx.Unlock()
+	eq.sampleRate = ctx.SampleRate
+	gain := dBToGain(eq.Params.Gain)
+	for i, v := range left {
+		left[i] = eq.next(0, v, gain, ctx.SampleRate)
+		if right != nil {
+			right[i] = eq.next(1, right[i], gain, ctx.SampleRate)
+		}
+	}
+}
+
+// next filters v of channel ch (0 left, 1 right) through all bands; mx must be locked
+func (eq *EQ) next(ch int, v float64, gain float64, sampleRate int) float64 {
+	for _, b := range eq.bands {
+		v = b.states[ch].next(b.coefficients(sampleRate), v)
+	}
+	return gain * v
+}
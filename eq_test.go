@@ -0,0 +1,83 @@
+package wavx
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEQMagnitudeResponse(t *testing.T) {
+	const sampleRate = 48000
+	eq, err := NewEQ(
+		EQBand{Type: EQLowCut, Freq: 30, Q: 1 / math.Sqrt2},
+		EQBand{Type: EQLowShelf, Freq: 200, Gain: -6, Q: 1 / math.Sqrt2},
+		EQBand{Type: EQPeak, Freq: 2000, Gain: 4, Q: 2},
+		EQBand{Type: EQHighCut, Freq: 18000, Q: 1 / math.Sqrt2},
+	)
+	if err != nil {
+		t.Fatalf("new-eq: %v", err)
+	}
+	tests := []struct {
+		freq   float64
+		wantDB float64
+		tol    float64
+	}{
+		{5, -30, 20},
+		{80, -6, 0.5},
+		{2000, 4, 0.1},
+		{600, 0, 0.5},
+	}
+	freqs := make([]float64, len(tests))
+	for i, test := range tests {
+		freqs[i] = test.freq
+	}
+	mags := eq.MagnitudeResponse(freqs, sampleRate)
+	for i, test := range tests {
+		if have := dB(mags[i]); math.Abs(have-test.wantDB) > test.tol {
+			t.Errorf("at %d Hz: want %.2f dB, have %.2f dB", int(test.freq), test.wantDB, have)
+		}
+	}
+
+	eq.Execute(Command{"band3.gain": "+3", "gain": "-2"})
+	band, err := eq.Band(3)
+	if err != nil {
+		t.Fatalf("band: %v", err)
+	}
+	if band.Gain != 7 {
+		t.Errorf("band 3: want gain 7, have %f", band.Gain)
+	}
+	if have := dB(eq.MagnitudeResponse([]float64{2000}, sampleRate)[0]); math.Abs(have-5) > 0.1 {
+		t.Errorf("after change: want 5 dB, have %.2f dB", have)
+	}
+
+	if err := eq.ChangeBand(5, Command{"gain": "1"}); err == nil {
+		t.Errorf("band 5: want error")
+	}
+	if err := eq.ChangeBand(1, Command{"type": "nope"}); err == nil {
+		t.Errorf("invalid type: want error")
+	}
+	if band, _ := eq.Band(1); band.Type != EQLowCut {
+		t.Errorf("invalid type: want band unchanged, have %q", band.Type)
+	}
+}
+
+func TestEQProcess(t *testing.T) {
+	const sampleRate = 48000
+	for _, freq := range []float64{100, 1000, 5000} {
+		eq, err := NewEQ(
+			EQBand{Type: EQPeak, Freq: 1000, Gain: 6, Q: 1},
+			EQBand{Type: EQHighShelf, Freq: 4000, Gain: -6, Q: 1 / math.Sqrt2},
+		)
+		if err != nil {
+			t.Fatalf("new-eq: %v", err)
+		}
+		osc := NewStdOscillator(StdOscillatorSine, freq, 1, 0)
+		eq.ConnectInput(EQInputSignal, osc)
+		buf := make([]float64, sampleRate)
+		eq.Process(&ProcessContext{SampleRate: sampleRate}, buf)
+		want := eq.MagnitudeResponse([]float64{freq}, sampleRate)[0]
+		// skip the transient
+		if have := rms(buf[sampleRate/2:]) * math.Sqrt2; math.Abs(have-want) > 0.01 {
+			t.Errorf("at %d Hz: want ampl %.3f, have %.3f", int(freq), want, have)
+		}
+	}
+}
@@ -20,13 +20,21 @@ type FilterParams struct {
 	Resonance float64
 }
 
+// filterState is the state of one channel of a Filter
+type filterState struct {
+	buf0, buf1 float64
+}
+
+// Filter is a resonant two pole filter; stereo signals are filtered per channel
 type Filter struct {
 	mx                sync.RWMutex
 	Params            FilterParams
 	inputSignal       Outputter
 	inputCutoffMod    Outputter
 	inputResonanceMod Outputter
-	buf0, buf1        float64
+	states            [2]filterState
+	cutoffModBuf      []float64
+	resonanceModBuf   []float64
 	Activator
 }
 
@@ -41,7 +49,8 @@ func NewFilter(mode FilterMode, baseCutoff float64, baseResonance float64) *Filt
 }
 
 const (
-	FilterInputSignal              = "signal"
+	FilterInputSignal = "signal"
+	// FilterInputCutoffModulation is added to the normalized cutoff
 	FilterInputCutoffModulation    = "cutoff-modulation"
 	FilterInputResonanceModulation = "resonance-modulation"
 )
@@ -108,6 +117,22 @@ func (f *Filter) ChangeResonance(res float64) {
 	f.Params.Resonance = res
 }
 
+func (f *Filter) carriesStereo() bool {
+	return f.inputSignal != nil && carriesStereo(f.inputSignal)
+}
+
+// modulated returns cutoff and resonance at secs
+func (f *Filter) modulated(params FilterParams, secs float64) (cutoff, resonance float64) {
+	cutoff, resonance = params.Cutoff, params.Resonance
+	if f.inputCutoffMod != nil {
+		cutoff += f.inputCutoffMod.Output(secs)
+	}
+	if f.inputResonanceMod != nil {
+		resonance += f.inputResonanceMod.Output(secs)
+	}
+	return cutoff, resonance
+}
+
 func (f *Filter) Output(secs float64) float64 {
 	if f.inputSignal == nil {
 		return 0
@@ -118,13 +143,78 @@ func (f *Filter) Output(secs float64) float64 {
 	}
 
 	params := f.Parameters()
-	mode, cutoff, resonance := params.Mode, params.Cutoff, params.Resonance
+	cutoff, resonance := f.modulated(params, secs)
+	return f.states[0].next(newVal, params.Mode, cutoff, resonance)
+}
+
+func (f *Filter) OutputStereo(secs float64) (left, right float64) {
+	if !f.carriesStereo() {
+		v := f.Output(secs)
+		return v, v
+	}
+	left, right = OutputStereo(f.inputSignal, secs)
+	if !f.IsActive() {
+		return left, right
+	}
+
+	params := f.Parameters()
+	cutoff, resonance := f.modulated(params, secs)
+	return f.states[0].next(left, params.Mode, cutoff, resonance), f.states[1].next(right, params.Mode, cutoff, resonance)
+}
+
+func (f *Filter) Process(ctx *ProcessContext, out []float64) {
+	if f.inputSignal == nil {
+		zeroBuffer(out)
+		return
+	}
+	ProcessBlock(ctx, f.inputSignal, out)
+	f.filter(ctx, out, nil)
+}
+
+func (f *Filter) ProcessStereo(ctx *ProcessContext, left, right []float64) {
+	if !f.carriesStereo() {
+		f.Process(ctx, left)
+		copy(right, left)
+		return
+	}
+	ProcessStereoBlock(ctx, f.inputSignal, left, right)
+	f.filter(ctx, left, right)
+}
+
+// filter filters the block in place; right is nil for a mono block
+func (f *Filter) filter(ctx *ProcessContext, left, right []float64) {
+	if !f.IsActive() {
+		return
+	}
+
+	params := f.Parameters()
+	var cutoffMod, resonanceMod []float64
 	if f.inputCutoffMod != nil {
-		cutoff += f.inputCutoffMod.Output(secs)
+		f.cutoffModBuf = growBuffer(f.cutoffModBuf, len(left))
+		cutoffMod = f.cutoffModBuf
+		ProcessBlock(ctx, f.inputCutoffMod, cutoffMod)
 	}
 	if f.inputResonanceMod != nil {
-		resonance += f.inputResonanceMod.Output(secs)
+		f.resonanceModBuf = growBuffer(f.resonanceModBuf, len(left))
+		resonanceMod = f.resonanceModBuf
+		ProcessBlock(ctx, f.inputResonanceMod, resonanceMod)
+	}
+	for i, v := range left {
+		cutoff, resonance := params.Cutoff, params.Resonance
+		if cutoffMod != nil {
+			cutoff += cutoffMod[i]
+		}
+		if resonanceMod != nil {
+			resonance += resonanceMod[i]
+		}
+		left[i] = f.states[0].next(v, params.Mode, cutoff, resonance)
+		if right != nil {
+			right[i] = f.states[1].next(right[i], params.Mode, cutoff, resonance)
+		}
 	}
+}
+
+func (s *filterState) next(newVal float64, mode FilterMode, cutoff, resonance float64) float64 {
 	if cutoff < 0 {
 		cutoff = 0
 	} else if cutoff >= 1.0 {
@@ -132,15 +222,15 @@ func (f *Filter) Output(secs float64) float64 {
 	}
 	feedback := resonance + resonance/(1.0-cutoff)
 
-	f.buf0 += cutoff * (newVal - f.buf0 + feedback*(f.buf0-f.buf1))
-	f.buf1 += cutoff * (f.buf0 - f.buf1)
+	s.buf0 += cutoff * (newVal - s.buf0 + feedback*(s.buf0-s.buf1))
+	s.buf1 += cutoff * (s.buf0 - s.buf1)
 	switch mode {
 	case FilterModeLowPass:
-		return f.buf1
+		return s.buf1
 	case FilterModeHighPass:
-		return newVal - f.buf0
+		return newVal - s.buf0
 	case FilterModeBandPass:
-		return f.buf0 - f.buf1
+		return s.buf0 - s.buf1
 	default:
 		return newVal
 	}
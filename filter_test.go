@@ -0,0 +1,177 @@
+package wavx
+
+import (
+	"math"
+	"testing"
+)
+
+// steadyAmpl returns the amplitude of the second half of n samples of f fed by a sine of freq
+func steadyAmpl(f InputOutputter, freq float64, sampleRate int) float64 {
+	f.ConnectInput("signal", NewStdOscillator(StdOscillatorSine, freq, 0.1, 0))
+	buf := make([]float64, sampleRate)
+	ProcessBlock(&ProcessContext{SampleRate: sampleRate}, f, buf)
+	return rms(buf[sampleRate/2:]) * math.Sqrt2 / 0.1
+}
+
+func TestSVFSlopes(t *testing.T) {
+	const sampleRate = 48000
+	tests := []struct {
+		mode     SVFMode
+		slope    int
+		freq     float64
+		min, max float64
+	}{
+		{SVFLowPass, 12, 100, -0.5, 0.5},
+		{SVFLowPass, 12, 4000, -26, -22},
+		{SVFLowPass, 24, 4000, -100, -45},
+		{SVFHighPass, 12, 10000, -0.5, 0.5},
+		{SVFHighPass, 12, 250, -26, -22},
+		{SVFHighPass, 24, 250, -100, -45},
+		{SVFBandPass, 12, 1000, -6.5, -5.5},
+		{SVFNotch, 12, 1000, math.Inf(-1), -30},
+	}
+	for _, test := range tests {
+		f := NewSVF(test.mode, 1000, 0, test.slope)
+		if have := dB(steadyAmpl(f, test.freq, sampleRate)); have < test.min || have > test.max {
+			t.Errorf("%s %d dB at %d Hz: want [%.1f, %.1f] dB, have %.2f dB", test.mode, test.slope, int(test.freq), test.min, test.max, have)
+		}
+	}
+}
+
+func TestSVFOutputs(t *testing.T) {
+	const sampleRate = 48000
+	f := NewSVF(SVFLowPass, 1000, 0.3, 12)
+	f.ConnectInput(SVFInputSignal, NewStdOscillator(StdOscillatorSawBL, 220, 0.1, 0))
+	ctx := &ProcessContext{SampleRate: sampleRate}
+	outs := map[string][]float64{}
+	for _, name := range f.Outputs() {
+		op, ok := f.OutputOf(name)
+		if !ok {
+			t.Fatalf("no output %q", name)
+		}
+		outs[name] = make([]float64, 512)
+		ProcessBlock(ctx, op, outs[name])
+	}
+	main := make([]float64, 512)
+	f.Process(ctx, main)
+	for i := range main {
+		if main[i] != outs["lowpass"][i] {
+			t.Fatalf("sample %d: main output %f differs from lowpass %f", i, main[i], outs["lowpass"][i])
+		}
+		if d := outs["notch"][i] - outs["lowpass"][i] - outs["highpass"][i]; math.Abs(d) > 1e-12 {
+			t.Fatalf("sample %d: notch is not lowpass + highpass", i)
+		}
+	}
+}
+
+func TestSVFMixedConsumers(t *testing.T) {
+	const sampleRate = 48000
+	newSVF := func() *SVF {
+		f := NewSVF(SVFLowPass, 1000, 0.3, 12)
+		f.ConnectInput(SVFInputSignal, NewStdOscillator(StdOscillatorSawBL, 220, 0.1, 0))
+		f.SetSampleRate(sampleRate)
+		return f
+	}
+	ref := newSVF()
+	want := make([]float64, 512)
+	ProcessBlock(&ProcessContext{SampleRate: sampleRate}, ref, want)
+
+	// the lowpass is read per sample, the highpass per block
+	f := newSVF()
+	low, _ := f.OutputOf("lowpass")
+	high, _ := f.OutputOf("highpass")
+	ctx := &ProcessContext{SampleRate: sampleRate}
+	have := make([]float64, 512)
+	highs := make([]float64, 512)
+	ProcessBlock(ctx, SampleAdapter{low}, have)
+	ProcessBlock(ctx, high, highs)
+	for i := range want {
+		if have[i] != want[i] {
+			t.Fatalf("sample %d: want %f, have %f", i, want[i], have[i])
+		}
+	}
+
+	// the same frame at another sample rate is computed again
+	other := make([]float64, 512)
+	ProcessBlock(&ProcessContext{SampleRate: 2 * sampleRate}, high, other)
+	for i := range other {
+		if other[i] != highs[i] {
+			return
+		}
+	}
+	t.Fatalf("want the block to be computed at the new sample rate")
+}
+
+func selfOscillation(t *testing.T, f InputOutputter, sampleRate int) {
+	t.Helper()
+	// a short burst excites the filter
+	burst := NewAmplituder(0.5)
+	burst.ConnectInput(AmplitudeInputSignal, NewNoise(NoiseWhite, 1, 1))
+	burst.ConnectInput(AmplitudeInputModulation, NewADSR(0, 0, 1, 0))
+	f.ConnectInput("signal", burst)
+	env := burst.inputModulation.(*ADSR)
+	env.GateOn()
+	ctx := &ProcessContext{SampleRate: sampleRate}
+	buf := make([]float64, sampleRate/100)
+	ProcessBlock(ctx, f, buf)
+	env.GateOff()
+	buf = make([]float64, sampleRate)
+	ctx.Frame += uint64(sampleRate / 100)
+	ProcessBlock(ctx, f, buf)
+	level := rms(buf[sampleRate/2:])
+	if level < 0.05 || level > 5 {
+		t.Fatalf("want a stable self-oscillation, have rms %f", level)
+	}
+	for i, v := range buf {
+		if math.IsNaN(v) || math.Abs(v) > 10 {
+			t.Fatalf("sample %d: unbounded %f", i, v)
+		}
+	}
+}
+
+func TestSVFLinear(t *testing.T) {
+	const sampleRate = 48000
+	// below the saturation the svf lowpass is the bilinear two pole lowpass, i.e. the biquad of Q = 1/k
+	const res = 0.5
+	f := NewSVF(SVFLowPass, 1000, res, 12)
+	f.ConnectInput(SVFInputSignal, NewStdOscillator(StdOscillatorSaw, 110, 4, 0))
+	bq := NewBiquad(BiquadLowPass, 1000, 1/(2-2.05*res), 0)
+	bq.ConnectInput(BiquadInputSignal, NewStdOscillator(StdOscillatorSaw, 110, 4, 0))
+	ctx := &ProcessContext{SampleRate: sampleRate}
+	have := make([]float64, sampleRate/10)
+	want := make([]float64, sampleRate/10)
+	ProcessBlock(ctx, f, have)
+	ProcessBlock(ctx, bq, want)
+	for i := range want {
+		if math.Abs(have[i]-want[i]) > 1e-9 {
+			t.Fatalf("sample %d: want %f, have %f", i, want[i], have[i])
+		}
+	}
+}
+
+func TestSVFSelfOscillation(t *testing.T) {
+	selfOscillation(t, NewSVF(SVFLowPass, 1000, 1, 12), 48000)
+}
+
+func TestLadder(t *testing.T) {
+	const sampleRate = 48000
+	tests := []struct {
+		slope    int
+		freq     float64
+		min, max float64
+	}{
+		{24, 50, -1, 0.5},
+		{24, 8000, -100, -45},
+		{12, 8000, -40, -22},
+	}
+	for _, test := range tests {
+		f := NewLadder(1000, 0, test.slope)
+		if have := dB(steadyAmpl(f, test.freq, sampleRate)); have < test.min || have > test.max {
+			t.Errorf("%d dB at %d Hz: want [%.1f, %.1f] dB, have %.2f dB", test.slope, int(test.freq), test.min, test.max, have)
+		}
+	}
+}
+
+func TestLadderSelfOscillation(t *testing.T) {
+	selfOscillation(t, NewLadder(1000, 1, 24), 48000)
+}
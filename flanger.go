@@ -0,0 +1,164 @@
+package wavx
+
+import (
+	"math"
+	"sync"
+
+	"github.com/mazzegi/log"
+)
+
+const (
+	FlangerInputSignal = "signal"
+	// FlangerInputDelayModulation is added to the delay time in ms
+	FlangerInputDelayModulation = "delay-modulation"
+)
+
+// FlangerParams holds the flanger params. Delay is the center and Depth the sweep of the delay time in ms, Rate is in Hz.
+// Feedback ranges from -1 to 1 (negative values invert the comb), Mix from 0 (dry) to 1 (wet).
+type FlangerParams struct {
+	Delay    float64
+	Depth    float64
+	Rate     float64
+	Feedback float64
+	Mix      float64
+}
+
+// Flanger sweeps a short feedback delay. The per-sample Output assumes SampelRate44100,
+// unless the sample rate is set by SetSampleRate or by a previous Process.
+type Flanger struct {
+	mx            sync.RWMutex
+	Params        FlangerParams
+	inputSignal   Outputter
+	inputDelayMod Outputter
+	delayModBuf   []float64
+	sampleRate    int
+	mod           modDelay
+	Activator
+}
+
+// NewFlanger creates a flanger with a feedback of 0.5, mixed half wet
+func NewFlanger(delayMsec float64, depthMsec float64, rate float64) *Flanger {
+	return &Flanger{
+		Params: FlangerParams{
+			Delay:    delayMsec,
+			Depth:    depthMsec,
+			Rate:     rate,
+			Feedback: 0.5,
+			Mix:      0.5,
+		},
+		sampleRate: SampelRate44100,
+		mod:        newModDelay(SampelRate44100),
+	}
+}
+
+func (f *Flanger) Inputs() []string {
+	return []string{
+		FlangerInputSignal,
+		FlangerInputDelayModulation,
+	}
+}
+
+func (f *Flanger) ConnectInput(input string, op Outputter) {
+	switch input {
+	case FlangerInputSignal:
+		f.inputSignal = op
+	case FlangerInputDelayModulation:
+		f.inputDelayMod = op
+	default:
+		log.Warnf("no such input %q", input)
+	}
+}
+
+func (f *Flanger) Execute(cmd Command) {
+	params := f.Parameters()
+	err := ApplyCommand(cmd, &params)
+	if err != nil {
+		log.Warnf("apply-command: %v", err)
+		return
+	}
+	f.ChangeParameters(params)
+}
+
+func (f *Flanger) Parameters() FlangerParams {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	return f.Params
+}
+
+func (f *Flanger) ChangeParameters(params FlangerParams) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.Params = params
+}
+
+func (f *Flanger) SetSampleRate(sampleRate int) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.setSampleRate(sampleRate)
+}
+
+// setSampleRate reallocates the delay line, if the sample rate changes; mx must be locked
+func (f *Flanger) setSampleRate(sampleRate int) {
+	if sampleRate == f.sampleRate {
+		return
+	}
+	f.sampleRate = sampleRate
+	f.mod = newModDelay(sampleRate)
+}
+
+func (f *Flanger) Output(secs float64) float64 {
+	if f.inputSignal == nil {
+		return 0
+	}
+	v := f.inputSignal.Output(secs)
+	if !f.IsActive() {
+		return v
+	}
+	var delayMod float64
+	if f.inputDelayMod != nil {
+		delayMod = f.inputDelayMod.Output(secs)
+	}
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return f.next(secs, v, f.Params, delayMod)
+}
+
+func (f *Flanger) Process(ctx *ProcessContext, out []float64) {
+	if f.inputSignal == nil {
+		zeroBuffer(out)
+		return
+	}
+	ProcessBlock(ctx, f.inputSignal, out)
+	if !f.IsActive() {
+		return
+	}
+	var delayMod []float64
+	if f.inputDelayMod != nil {
+		f.delayModBuf = growBuffer(f.delayModBuf, len(out))
+		delayMod = f.delayModBuf
+		ProcessBlock(ctx, f.inputDelayMod, delayMod)
+	}
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.setSampleRate(ctx.SampleRate)
+	params := f.Params
+	for i, v := range out {
+		var dm float64
+		if delayMod != nil {
+			dm = delayMod[i]
+		}
+		out[i] = f.next(ctx.Secs(i), v, params, dm)
+	}
+}
+
+// next computes the next sample; mx must be locked
+func (f *Flanger) next(secs float64, v float64, params FlangerParams, delayMod float64) float64 {
+	msecs := float64(f.sampleRate) / 1000
+	f.mod.advance(secs, params.Rate, (params.Delay+delayMod)*msecs)
+	wet := f.mod.tap(params.Depth*msecs, 0)
+	fb := math.Max(-maxModFeedback, math.Min(params.Feedback, maxModFeedback))
+	f.mod.line.Write(v + fb*wet)
+
+	mix := clamp01(params.Mix)
+	return (1-mix)*v + mix*wet
+}
@@ -0,0 +1,372 @@
+package wavx
+
+import (
+	"math"
+	"sync"
+
+	"github.com/mazzegi/log"
+	"github.com/pkg/errors"
+)
+
+// FMAlgorithm describes how the operators are connected. Operators may only be modulated by operators
+// with a higher index; the operator with the highest index has the feedback loop.
+type FMAlgorithm struct {
+	// Modulators holds the indices of the modulating operators per operator
+	Modulators [][]int
+	// Carriers holds the indices of the operators which are audible
+	Carriers []int
+}
+
+// FMAlgorithms are the DX-style algorithms for four operators (0 = op1, ..., 3 = op4)
+var FMAlgorithms = []FMAlgorithm{
+	// 1: 4 -> 3 -> 2 -> 1
+	{Modulators: [][]int{{1}, {2}, {3}, {}}, Carriers: []int{0}},
+	// 2: (3 + 4) -> 2 -> 1
+	{Modulators: [][]int{{1}, {2, 3}, {}, {}}, Carriers: []int{0}},
+	// 3: 3 -> 2 -> 1, 4 -> 1
+	{Modulators: [][]int{{1, 3}, {2}, {}, {}}, Carriers: []int{0}},
+	// 4: 4 -> 3 -> 1, 2 -> 1
+	{Modulators: [][]int{{1, 2}, {}, {3}, {}}, Carriers: []int{0}},
+	// 5: 2 -> 1, 4 -> 3
+	{Modulators: [][]int{{1}, {}, {3}, {}}, Carriers: []int{0, 2}},
+	// 6: 4 -> 1, 4 -> 2, 4 -> 3
+	{Modulators: [][]int{{3}, {3}, {3}, {}}, Carriers: []int{0, 1, 2}},
+	// 7: 4 -> 3, 1, 2
+	{Modulators: [][]int{{}, {}, {3}, {}}, Carriers: []int{0, 1, 2}},
+	// 8: 1, 2, 3, 4
+	{Modulators: [][]int{{}, {}, {}, {}}, Carriers: []int{0, 1, 2, 3}},
+}
+
+func (a FMAlgorithm) validate(numOps int) error {
+	if len(a.Modulators) != numOps {
+		return errors.Errorf("algorithm has %d operators, voice has %d", len(a.Modulators), numOps)
+	}
+	for op, mods := range a.Modulators {
+		for _, m := range mods {
+			if m <= op || m >= numOps {
+				return errors.Errorf("operator %d cannot be modulated by operator %d", op, m)
+			}
+		}
+	}
+	if len(a.Carriers) == 0 {
+		return errors.Errorf("algorithm has no carriers")
+	}
+	for _, c := range a.Carriers {
+		if c < 0 || c >= numOps {
+			return errors.Errorf("invalid carrier %d", c)
+		}
+	}
+	return nil
+}
+
+// FMOperatorParams holds the params of a single operator; Ratio is relative to the voice frequency,
+// attack, decay and release are in seconds
+type FMOperatorParams struct {
+	Ratio   float64
+	Level   float64
+	Attack  float64
+	Decay   float64
+	Sustain float64
+	Release float64
+}
+
+func (p FMOperatorParams) envelopeParams() EnvelopeParams {
+	return EnvelopeParams{
+		Attack:  p.Attack,
+		Decay:   p.Decay,
+		Sustain: p.Sustain,
+		Release: p.Release,
+	}
+}
+
+// FMParams holds the voice params; Algorithm selects one of FMAlgorithms (1-based), Feedback ranges from 0 to 1
+type FMParams struct {
+	Freq      float64
+	Ampl      float64
+	Algorithm int
+	Feedback  float64
+}
+
+const (
+	// FMInputFreqMod expects a frequency deviation in Hz
+	FMInputFreqMod = "frequency-modulation"
+)
+
+type fmOperator struct {
+	params FMOperatorParams
+	env    *Envelope
+	phase  float64
+	out    float64
+}
+
+// FMVoice is a monophonic FM voice of N operators. Activate starts the envelopes of all operators (note on),
+// Deactivate releases them (note off). The output of a modulator is added to the phase of the modulated operator in cycles.
+type FMVoice struct {
+	mx           sync.RWMutex
+	Params       FMParams
+	algorithm    FMAlgorithm
+	ops          []*fmOperator
+	freqModInput Outputter
+	freqModBuf   []float64
+	clock        sampleClock
+	gateOn       bool
+	gateOff      bool
+	fb1, fb2     float64
+}
+
+// NewFMVoice creates a voice of numOps operators with ratio 1 and full level. Voices with four operators use algorithm 1,
+// other voices a stack of all operators.
+func NewFMVoice(numOps int, freq float64, ampl float64) *FMVoice {
+	if numOps < 1 {
+		numOps = 1
+	}
+	v := &FMVoice{
+		Params: FMParams{
+			Freq:      freq,
+			Ampl:      ampl,
+			Algorithm: 1,
+		},
+	}
+	for i := 0; i < numOps; i++ {
+		params := FMOperatorParams{
+			Ratio:   1,
+			Level:   1,
+			Attack:  0.01,
+			Decay:   0.2,
+			Sustain: 0.8,
+			Release: 0.3,
+		}
+		v.ops = append(v.ops, &fmOperator{
+			params: params,
+			env:    NewEnvelope(params.envelopeParams()),
+		})
+	}
+	if numOps == len(FMAlgorithms[0].Modulators) {
+		v.algorithm = FMAlgorithms[0]
+	} else {
+		v.algorithm = fmStack(numOps)
+		v.Params.Algorithm = 0
+	}
+	return v
+}
+
+// fmStack connects the operators in series: n -> n-1 -> ... -> 1
+func fmStack(numOps int) FMAlgorithm {
+	a := FMAlgorithm{
+		Modulators: make([][]int, numOps),
+		Carriers:   []int{0},
+	}
+	for i := 0; i < numOps-1; i++ {
+		a.Modulators[i] = []int{i + 1}
+	}
+	return a
+}
+
+func (v *FMVoice) Inputs() []string {
+	return []string{
+		FMInputFreqMod,
+	}
+}
+
+func (v *FMVoice) ConnectInput(input string, op Outputter) {
+	switch input {
+	case FMInputFreqMod:
+		v.freqModInput = op
+	default:
+		log.Warnf("no such input %q", input)
+	}
+}
+
+func (v *FMVoice) Activate() {
+	v.GateOn()
+}
+
+func (v *FMVoice) Deactivate() {
+	v.GateOff()
+}
+
+// GateOn starts the envelopes of all operators with the next sample
+func (v *FMVoice) GateOn() {
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	v.gateOn = true
+	v.gateOff = false
+}
+
+// GateOff releases the envelopes of all operators with the next sample
+func (v *FMVoice) GateOff() {
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	v.gateOff = true
+	v.gateOn = false
+}
+
+// NoteOn changes the frequency and starts the envelopes, so a FMVoice may be used as a Voice
+func (v *FMVoice) NoteOn(freq float64) {
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	v.Params.Freq = freq
+	v.gateOn = true
+	v.gateOff = false
+}
+
+func (v *FMVoice) NoteOff() {
+	v.GateOff()
+}
+
+// Execute changes the voice params (e.g. freq:440, algorithm:5) and the operator params (e.g. op2.ratio:2, op1.attack:0.1)
+func (v *FMVoice) Execute(cmd Command) {
+	rest, opCmds, err := SplitIndexedCommand(cmd, "op")
+	if err != nil {
+		log.Warnf("fm: %v", err)
+		return
+	}
+	for n, opCmd := range opCmds {
+		err := v.ChangeOperator(n, opCmd)
+		if err != nil {
+			log.Warnf("fm: %v", err)
+			return
+		}
+	}
+	if len(rest) == 0 {
+		return
+	}
+	params := v.Parameters()
+	err = ApplyCommand(rest, &params)
+	if err != nil {
+		log.Warnf("apply-command: %v", err)
+		return
+	}
+	err = v.ChangeParameters(params)
+	if err != nil {
+		log.Warnf("fm: %v", err)
+	}
+}
+
+func (v *FMVoice) Parameters() FMParams {
+	v.mx.RLock()
+	defer v.mx.RUnlock()
+	return v.Params
+}
+
+func (v *FMVoice) ChangeParameters(params FMParams) error {
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	if params.Algorithm != v.Params.Algorithm {
+		if params.Algorithm < 1 || params.Algorithm > len(FMAlgorithms) {
+			return errors.Errorf("no such algorithm %d", params.Algorithm)
+		}
+		alg := FMAlgorithms[params.Algorithm-1]
+		if err := alg.validate(len(v.ops)); err != nil {
+			return errors.Wrapf(err, "algorithm %d", params.Algorithm)
+		}
+		v.algorithm = alg
+	}
+	v.Params = params
+	return nil
+}
+
+// SetAlgorithm connects the operators with a custom algorithm
+func (v *FMVoice) SetAlgorithm(alg FMAlgorithm) error {
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	if err := alg.validate(len(v.ops)); err != nil {
+		return err
+	}
+	v.algorithm = alg
+	v.Params.Algorithm = 0
+	return nil
+}
+
+// ChangeOperator applies cmd to the params of operator n (1-based)
+func (v *FMVoice) ChangeOperator(n int, cmd Command) error {
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	if n < 1 || n > len(v.ops) {
+		return errors.Errorf("no such operator %d", n)
+	}
+	op := v.ops[n-1]
+	params := op.params
+	err := ApplyCommand(cmd, &params)
+	if err != nil {
+		return errors.Wrapf(err, "operator %d", n)
+	}
+	op.params = params
+	op.env.params = params.envelopeParams()
+	return nil
+}
+
+func (v *FMVoice) Output(secs float64) float64 {
+	var freqMod float64
+	if v.freqModInput != nil {
+		freqMod = v.freqModInput.Output(secs)
+	}
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	return v.next(secs, freqMod)
+}
+
+func (v *FMVoice) Process(ctx *ProcessContext, out []float64) {
+	var freqMod []float64
+	if v.freqModInput != nil {
+		v.freqModBuf = growBuffer(v.freqModBuf, len(out))
+		freqMod = v.freqModBuf
+		ProcessBlock(ctx, v.freqModInput, freqMod)
+	}
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	for i := range out {
+		var fm float64
+		if freqMod != nil {
+			fm = freqMod[i]
+		}
+		out[i] = v.next(ctx.Secs(i), fm)
+	}
+}
+
+// next computes the next sample; mx must be locked
+func (v *FMVoice) next(secs float64, freqMod float64) float64 {
+	if v.gateOn {
+		for _, op := range v.ops {
+			op.env.Start(secs)
+		}
+		v.gateOn = false
+	}
+	if v.gateOff {
+		for _, op := range v.ops {
+			op.env.Release(secs)
+		}
+		v.gateOff = false
+	}
+
+	dt := v.clock.elapsed(secs)
+	freq := v.Params.Freq + freqMod
+	last := len(v.ops) - 1
+	for i := last; i >= 0; i-- {
+		op := v.ops[i]
+		var mod float64
+		for _, m := range v.algorithm.Modulators[i] {
+			mod += v.ops[m].out
+		}
+		if i == last {
+			// the feedback averages the last two outputs; full feedback shifts the phase by half a cycle
+			mod += 0.5 * v.Params.Feedback * (v.fb1 + v.fb2) / 2
+		}
+		op.phase = fract(op.phase + freq*op.params.Ratio*dt)
+		var env float64
+		if op.env.IsActive() {
+			env = op.env.Value(secs)
+		}
+		op.out = op.params.Level * env * math.Sin(2*math.Pi*(op.phase+mod))
+		if i == last {
+			v.fb2 = v.fb1
+			v.fb1 = op.out
+		}
+	}
+
+	var sum float64
+	for _, c := range v.algorithm.Carriers {
+		sum += v.ops[c].out
+	}
+	return v.Params.Ampl * sum / float64(len(v.algorithm.Carriers))
+}
@@ -0,0 +1,43 @@
+package wavx
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFMVoiceCarrierOnly(t *testing.T) {
+	v := NewFMVoice(4, 441, 0.5)
+	v.Execute(Command{
+		"op1.attack":  "0",
+		"op1.sustain": "1",
+		"op2.level":   "0",
+		"op3.level":   "0",
+		"op4.level":   "0",
+	})
+	v.Activate()
+
+	ctx := &ProcessContext{SampleRate: SampelRate44100}
+	buf := make([]float64, 200)
+	v.Process(ctx, buf)
+	for i, have := range buf {
+		want := 0.5 * math.Sin(2*math.Pi*441*float64(i)/SampelRate44100)
+		if math.Abs(have-want) > 1e-9 {
+			t.Fatalf("sample %d: want %f, have %f", i, want, have)
+		}
+	}
+}
+
+func TestFMVoiceAlgorithms(t *testing.T) {
+	v := NewFMVoice(4, 220, 1)
+	for n := range FMAlgorithms {
+		if err := v.ChangeParameters(FMParams{Freq: 220, Ampl: 1, Algorithm: n + 1}); err != nil {
+			t.Errorf("algorithm %d: %v", n+1, err)
+		}
+	}
+	if err := v.ChangeParameters(FMParams{Algorithm: len(FMAlgorithms) + 1}); err == nil {
+		t.Errorf("want error for unknown algorithm")
+	}
+	if err := v.SetAlgorithm(FMAlgorithm{Modulators: [][]int{{}, {0}, {}, {}}, Carriers: []int{0}}); err == nil {
+		t.Errorf("want error for modulation by a lower operator")
+	}
+}
@@ -0,0 +1,228 @@
+package wavx
+
+import (
+	"math"
+	"sync"
+
+	"github.com/mazzegi/log"
+)
+
+const (
+	LadderInputSignal = "signal"
+	// LadderInputCutoffOctaveModulation is in octaves, so +1 doubles the cutoff
+	LadderInputCutoffOctaveModulation = "cutoff-octave-modulation"
+	// LadderInputCutoffModulation is the input name of Filter, which is accepted as an alias of LadderInputCutoffOctaveModulation
+	LadderInputCutoffModulation = FilterInputCutoffModulation
+	// LadderInputResonanceModulation is added to the resonance
+	LadderInputResonanceModulation = "resonance-modulation"
+)
+
+// LadderParams holds the ladder params; Cutoff is in Hz, Resonance in [0, 1] self-oscillates near 1,
+// Slope is 12 or 24 dB/octave, Drive is the gain in front of the saturating stages
+type LadderParams struct {
+	Cutoff    float64
+	Resonance float64
+	Slope     int
+	Drive     float64
+}
+
+// Ladder is a Moog-style 4-pole lowpass filter. Each stage saturates (tanh), which keeps the resonance bounded,
+// even when it self-oscillates. The 12 dB slope taps the second stage, the feedback always comes from the fourth.
+// Stereo signals are filtered per channel.
+type Ladder struct {
+	mx                sync.RWMutex
+	Params            LadderParams
+	inputSignal       Outputter
+	inputCutoffMod    Outputter
+	inputResonanceMod Outputter
+	cutoffModBuf      []float64
+	resonanceModBuf   []float64
+	sampleRate        int
+	// stages holds the stages of the left and the right channel
+	stages [2][4]float64
+	Activator
+}
+
+func NewLadder(cutoff float64, resonance float64, slope int) *Ladder {
+	return &Ladder{
+		Params: LadderParams{
+			Cutoff:    cutoff,
+			Resonance: resonance,
+			Slope:     slope,
+			Drive:     1,
+		},
+		sampleRate: SampelRate44100,
+	}
+}
+
+func (f *Ladder) Inputs() []string {
+	return []string{
+		LadderInputSignal,
+		LadderInputCutoffOctaveModulation,
+		LadderInputCutoffModulation,
+		LadderInputResonanceModulation,
+	}
+}
+
+func (f *Ladder) ConnectInput(input string, op Outputter) {
+	switch input {
+	case LadderInputSignal:
+		f.inputSignal = op
+	case LadderInputCutoffOctaveModulation, LadderInputCutoffModulation:
+		f.inputCutoffMod = op
+	case LadderInputResonanceModulation:
+		f.inputResonanceMod = op
+	default:
+		log.Warnf("no such input %q", input)
+	}
+}
+
+func (f *Ladder) Execute(cmd Command) {
+	params := f.Parameters()
+	err := ApplyCommand(cmd, &params)
+	if err != nil {
+		log.Warnf("apply-command: %v", err)
+		return
+	}
+	f.ChangeParameters(params)
+}
+
+func (f *Ladder) Parameters() LadderParams {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	return f.Params
+}
+
+func (f *Ladder) ChangeParameters(params LadderParams) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.Params = params
+}
+
+func (f *Ladder) SetSampleRate(sampleRate int) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.sampleRate = sampleRate
+}
+
+func (f *Ladder) carriesStereo() bool {
+	return f.inputSignal != nil && carriesStereo(f.inputSignal)
+}
+
+// modulation returns the cutoff and the resonance modulation at secs
+func (f *Ladder) modulation(secs float64) (cutoffMod, resonanceMod float64) {
+	if f.inputCutoffMod != nil {
+		cutoffMod = f.inputCutoffMod.Output(secs)
+	}
+	if f.inputResonanceMod != nil {
+		resonanceMod = f.inputResonanceMod.Output(secs)
+	}
+	return cutoffMod, resonanceMod
+}
+
+func (f *Ladder) Output(secs float64) float64 {
+	if f.inputSignal == nil {
+		return 0
+	}
+	v := f.inputSignal.Output(secs)
+	if !f.IsActive() {
+		return v
+	}
+	cutoffMod, resonanceMod := f.modulation(secs)
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return f.next(&f.stages[0], v, f.Params, cutoffMod, resonanceMod, f.sampleRate)
+}
+
+func (f *Ladder) OutputStereo(secs float64) (left, right float64) {
+	if !f.carriesStereo() {
+		v := f.Output(secs)
+		return v, v
+	}
+	left, right = OutputStereo(f.inputSignal, secs)
+	if !f.IsActive() {
+		return left, right
+	}
+	cutoffMod, resonanceMod := f.modulation(secs)
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return f.next(&f.stages[0], left, f.Params, cutoffMod, resonanceMod, f.sampleRate),
+		f.next(&f.stages[1], right, f.Params, cutoffMod, resonanceMod, f.sampleRate)
+}
+
+func (f *Ladder) Process(ctx *ProcessContext, out []float64) {
+	if f.inputSignal == nil {
+		zeroBuffer(out)
+		return
+	}
+	ProcessBlock(ctx, f.inputSignal, out)
+	f.filter(ctx, out, nil)
+}
+
+func (f *Ladder) ProcessStereo(ctx *ProcessContext, left, right []float64) {
+	if !f.carriesStereo() {
+		f.Process(ctx, left)
+		copy(right, left)
+		return
+	}
+	ProcessStereoBlock(ctx, f.inputSignal, left, right)
+	f.filter(ctx, left, right)
+}
+
+// filter filters the block in place; right is nil for a mono block
+func (f *Ladder) filter(ctx *ProcessContext, left, right []float64) {
+	if !f.IsActive() {
+		return
+	}
+	var cutoffMod, resonanceMod []float64
+	if f.inputCutoffMod != nil {
+		f.cutoffModBuf = growBuffer(f.cutoffModBuf, len(left))
+		cutoffMod = f.cutoffModBuf
+		ProcessBlock(ctx, f.inputCutoffMod, cutoffMod)
+	}
+	if f.inputResonanceMod != nil {
+		f.resonanceModBuf = growBuffer(f.resonanceModBuf, len(left))
+		resonanceMod = f.resonanceModBuf
+		ProcessBlock(ctx, f.inputResonanceMod, resonanceMod)
+	}
+
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.sampleRate = ctx.SampleRate
+	for i, v := range left {
+		var cm, rm float64
+		if cutoffMod != nil {
+			cm = cutoffMod[i]
+		}
+		if resonanceMod != nil {
+			rm = resonanceMod[i]
+		}
+		left[i] = f.next(&f.stages[0], v, f.Params, cm, rm, ctx.SampleRate)
+		if right != nil {
+			right[i] = f.next(&f.stages[1], right[i], f.Params, cm, rm, ctx.SampleRate)
+		}
+	}
+}
+
+// next filters the next sample through the stages s; mx must be locked
+func (f *Ladder) next(s *[4]float64, v float64, params LadderParams, cutoffMod, resonanceMod float64, sampleRate int) float64 {
+	cutoff := params.Cutoff * math.Pow(2, cutoffMod)
+	cutoff = math.Max(minBiquadCutoff, math.Min(cutoff, 0.45*float64(sampleRate)))
+	g := 1 - math.Exp(-2*math.Pi*cutoff/float64(sampleRate))
+	res := math.Max(0, math.Min(params.Resonance+resonanceMod, 1.2))
+	// the unit delay of the feedback raises the gain needed for the self-oscillation above 4,
+	// depending on g; full resonance is slightly above this threshold
+	gc := math.Min(g, 0.7)
+	comp := (2 - gc) / (2 - 2*gc)
+	k := 4.2 * comp * comp * res
+
+	x := math.Tanh(params.Drive*v - k*s[3])
+	s[0] += g * (x - math.Tanh(s[0]))
+	s[1] += g * (math.Tanh(s[0]) - math.Tanh(s[1]))
+	s[2] += g * (math.Tanh(s[1]) - math.Tanh(s[2]))
+	s[3] += g * (math.Tanh(s[2]) - math.Tanh(s[3]))
+	if params.Slope == 12 {
+		return s[1]
+	}
+	return s[3]
+}
@@ -18,3 +18,10 @@ func NewLFO(typ StdOscillatorType, offset, amplitude, freq float64) *LFO {
 func (lfo *LFO) Output(secs float64) float64 {
 	return lfo.offset + lfo.amplitude*lfo.osc.Output(secs)
 }
+
+func (lfo *LFO) Process(ctx *ProcessContext, out []float64) {
+	lfo.osc.Process(ctx, out)
+	for i, v := range out {
+		out[i] = lfo.offset + lfo.amplitude*v
+	}
+}
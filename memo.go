@@ -0,0 +1,187 @@
+package wavx
+
+import "math"
+
+// Memo caches the output of a component, so that it is computed exactly once per sample or block,
+// no matter how many components consume it. Stateful components which feed more than one input (fan-out)
+// must be connected through a Memo, otherwise they advance their state once per consumer.
+// Stereo components are always evaluated in stereo; mono consumers read the mid signal.
+type Memo struct {
+	op     Outputter
+	stereo bool
+	cache  *frameCache
+}
+
+func NewMemo(op Outputter) *Memo {
+	m := &Memo{
+		op:     op,
+		stereo: isStereo(op),
+	}
+	channels := 1
+	if m.stereo {
+		channels = 2
+	}
+	m.cache = newFrameCache(channels)
+	return m
+}
+
+// Outputter returns the wrapped component
+func (m *Memo) Outputter() Outputter {
+	return m.op
+}
+
+func (m *Memo) carriesStereo() bool {
+	return m.stereo && carriesStereo(m.op)
+}
+
+func (m *Memo) nextSample(secs float64, vals []float64) {
+	if m.stereo {
+		vals[0], vals[1] = OutputStereo(m.op, secs)
+		return
+	}
+	vals[0] = m.op.Output(secs)
+}
+
+func (m *Memo) nextBlock(ctx *ProcessContext, blocks [][]float64) {
+	if m.stereo {
+		ProcessStereoBlock(ctx, m.op, blocks[0], blocks[1])
+		return
+	}
+	ProcessBlock(ctx, m.op, blocks[0])
+}
+
+func (m *Memo) Output(secs float64) float64 {
+	vals := m.cache.sample(m, secs)
+	if m.stereo {
+		return (vals[0] + vals[1]) / 2
+	}
+	return vals[0]
+}
+
+func (m *Memo) OutputStereo(secs float64) (left, right float64) {
+	vals := m.cache.sample(m, secs)
+	if m.stereo {
+		return vals[0], vals[1]
+	}
+	return vals[0], vals[0]
+}
+
+func (m *Memo) Process(ctx *ProcessContext, out []float64) {
+	blocks := m.cache.fill(m, ctx, len(out))
+	if m.stereo {
+		midBuffer(out, blocks[0], blocks[1])
+		return
+	}
+	copy(out, blocks[0])
+}
+
+func (m *Memo) ProcessStereo(ctx *ProcessContext, left, right []float64) {
+	blocks := m.cache.fill(m, ctx, len(left))
+	copy(left, blocks[0])
+	if m.stereo {
+		copy(right, blocks[1])
+		return
+	}
+	copy(right, blocks[0])
+}
+
+// frameSource computes the channels of a frameCache
+type frameSource interface {
+	// nextSample writes the channels at secs to vals
+	nextSample(secs float64, vals []float64)
+	// nextBlock renders the channels of the block at ctx; all blocks have the same length
+	nextBlock(ctx *ProcessContext, blocks [][]float64)
+}
+
+// maxFrameRun bounds the samples, which are kept for block consumers, if a cache is only read per sample
+const maxFrameRun = 4 * DefaultFramesPerBuffer
+
+// frameCache computes the channels of a frameSource once per sample or block. Per-sample and block consumers
+// may be mixed: samples, which were computed per sample, are taken over by a block of the same frames
+// and per-sample reads of the current block are served from it, so the source never advances twice.
+type frameCache struct {
+	vals []float64
+	// run holds the consecutive samples, which were computed per sample since the last block
+	runSecs []float64
+	run     [][]float64
+
+	hasBlock   bool
+	frame      uint64
+	sampleRate int
+	blocks     [][]float64
+	rest       [][]float64
+}
+
+func newFrameCache(channels int) *frameCache {
+	return &frameCache{
+		vals:   make([]float64, channels),
+		run:    make([][]float64, channels),
+		blocks: make([][]float64, channels),
+		rest:   make([][]float64, channels),
+	}
+}
+
+// sample returns the channels at secs; the result is valid until the next call
+func (c *frameCache) sample(src frameSource, secs float64) []float64 {
+	if n := len(c.runSecs); n > 0 && secs == c.runSecs[n-1] {
+		for ch := range c.vals {
+			c.vals[ch] = c.run[ch][n-1]
+		}
+		return c.vals
+	}
+	if c.hasBlock {
+		idx := int64(math.Round(secs*float64(c.sampleRate))) - int64(c.frame)
+		if idx >= 0 && idx < int64(len(c.blocks[0])) {
+			for ch := range c.vals {
+				c.vals[ch] = c.blocks[ch][idx]
+			}
+			return c.vals
+		}
+	}
+	src.nextSample(secs, c.vals)
+	if len(c.runSecs) >= maxFrameRun {
+		c.resetRun()
+	}
+	c.runSecs = append(c.runSecs, secs)
+	for ch, v := range c.vals {
+		c.run[ch] = append(c.run[ch], v)
+	}
+	c.hasBlock = false
+	return c.vals
+}
+
+func (c *frameCache) resetRun() {
+	c.runSecs = c.runSecs[:0]
+	for ch := range c.run {
+		c.run[ch] = c.run[ch][:0]
+	}
+}
+
+// fill returns the channels of the block of n frames at ctx
+func (c *frameCache) fill(src frameSource, ctx *ProcessContext, n int) [][]float64 {
+	if c.hasBlock && ctx.Frame == c.frame && ctx.SampleRate == c.sampleRate && n == len(c.blocks[0]) {
+		return c.blocks
+	}
+	for ch := range c.blocks {
+		c.blocks[ch] = growBuffer(c.blocks[ch], n)
+	}
+	// take over the leading samples, which were already computed per sample
+	k := 0
+	for k < n && k < len(c.runSecs) && c.runSecs[k] == ctx.Secs(k) {
+		for ch := range c.blocks {
+			c.blocks[ch][k] = c.run[ch][k]
+		}
+		k++
+	}
+	c.resetRun()
+	if k < n {
+		for ch := range c.blocks {
+			c.rest[ch] = c.blocks[ch][k:]
+		}
+		src.nextBlock(&ProcessContext{SampleRate: ctx.SampleRate, Frame: ctx.Frame + uint64(k)}, c.rest)
+	}
+	c.frame = ctx.Frame
+	c.sampleRate = ctx.SampleRate
+	c.hasBlock = true
+	return c.blocks
+}
@@ -0,0 +1,104 @@
+package wavx
+
+import (
+	"math"
+	"testing"
+)
+
+type countingOutputter struct {
+	calls int
+}
+
+func (c *countingOutputter) Output(secs float64) float64 {
+	c.calls++
+	return float64(c.calls)
+}
+
+func TestMemoFanOut(t *testing.T) {
+	counter := &countingOutputter{}
+	memo := NewMemo(counter)
+
+	adder := NewAdder()
+	adder.ConnectInput(AdderInput, memo)
+	adder.ConnectInput(AdderInput, memo)
+
+	synth := NewSynthesizer(SampelRate44100, adder, nil)
+	synth.SetChannels(1)
+	buf := make([]float64, 64)
+	synth.Render(buf)
+	if counter.calls != len(buf) {
+		t.Fatalf("want %d calls, have %d", len(buf), counter.calls)
+	}
+	for i, v := range buf {
+		if v != float64(i+1) {
+			t.Fatalf("sample %d: want %f, have %f", i, float64(i+1), v)
+		}
+	}
+
+	// per sample consumers read the cached block
+	if v := memo.Output(float64(10) / SampelRate44100); v != 11 {
+		t.Fatalf("want cached value 11, have %f", v)
+	}
+	if counter.calls != len(buf) {
+		t.Fatalf("want %d calls, have %d", len(buf), counter.calls)
+	}
+}
+
+func TestMemoStatefulFanOut(t *testing.T) {
+	newFilter := func() *Filter {
+		f := NewFilter(FilterModeLowPass, 0.2, 0.6)
+		f.ConnectInput(FilterInputSignal, NewStdOscillator(StdOscillatorSaw, 220, 1, 0))
+		return f
+	}
+
+	single := NewSynthesizer(SampelRate44100, newFilter(), nil)
+	single.SetChannels(1)
+
+	memo := NewMemo(newFilter())
+	adder := NewAdder()
+	adder.ConnectInput(AdderInput, memo)
+	adder.ConnectInput(AdderInput, memo)
+	shared := NewSynthesizer(SampelRate44100, adder, nil)
+	shared.SetChannels(1)
+
+	want := make([]float64, 512)
+	have := make([]float64, 512)
+	single.Render(want)
+	shared.Render(have)
+	for i := range want {
+		if math.Abs(want[i]-have[i]) > 1e-12 {
+			t.Fatalf("sample %d: want %f, have %f", i, want[i], have[i])
+		}
+	}
+}
+
+func TestMemoMixedConsumers(t *testing.T) {
+	for _, perSampleFirst := range []bool{true, false} {
+		counter := &countingOutputter{}
+		memo := NewMemo(counter)
+
+		adder := NewAdder()
+		if perSampleFirst {
+			adder.ConnectInput(AdderInput, SampleAdapter{memo})
+			adder.ConnectInput(AdderInput, memo)
+		} else {
+			adder.ConnectInput(AdderInput, memo)
+			adder.ConnectInput(AdderInput, SampleAdapter{memo})
+		}
+
+		synth := NewSynthesizer(SampelRate44100, adder, nil)
+		synth.SetChannels(1)
+		buf := make([]float64, 64)
+		for block := 0; block < 3; block++ {
+			synth.Render(buf)
+			for i, v := range buf {
+				if want := float64(block*len(buf) + i + 1); v != want {
+					t.Fatalf("per-sample first %t, block %d, sample %d: want %f, have %f", perSampleFirst, block, i, want, v)
+				}
+			}
+		}
+		if counter.calls != 3*len(buf) {
+			t.Fatalf("per-sample first %t: want %d calls, have %d", perSampleFirst, 3*len(buf), counter.calls)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package wavx
+
+// MultiOutputter is implemented by components with more than one output. Output is the main output,
+// OutputOf returns the other ones by name.
+type MultiOutputter interface {
+	Outputter
+	Outputs() []string
+	OutputOf(name string) (Outputter, bool)
+}
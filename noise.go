@@ -0,0 +1,128 @@
+package wavx
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/mazzegi/log"
+)
+
+type NoiseColor string
+
+const (
+	NoiseWhite NoiseColor = "white"
+	NoisePink  NoiseColor = "pink"
+	NoiseBrown NoiseColor = "brown"
+)
+
+// NoiseParams holds the noise params; the same seed always produces the same sequence
+type NoiseParams struct {
+	Color NoiseColor
+	Ampl  float64
+	Seed  int64
+}
+
+// Noise generates white, pink (-3 dB/octave) and brown (-6 dB/octave) noise from a seedable generator
+type Noise struct {
+	mx     sync.RWMutex
+	Params NoiseParams
+	rng    *rand.Rand
+	pink   [7]float64
+	brown  float64
+	Activator
+}
+
+func NewNoise(color NoiseColor, ampl float64, seed int64) *Noise {
+	return &Noise{
+		Params: NoiseParams{
+			Color: color,
+			Ampl:  ampl,
+			Seed:  seed,
+		},
+		rng: rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (n *Noise) Inputs() []string {
+	return []string{}
+}
+
+func (n *Noise) ConnectInput(input string, op Outputter) {
+	log.Warnf("no inputs accepted")
+}
+
+func (n *Noise) Execute(cmd Command) {
+	params := n.Parameters()
+	err := ApplyCommand(cmd, &params)
+	if err != nil {
+		log.Warnf("apply-command: %v", err)
+		return
+	}
+	n.ChangeParameters(params)
+}
+
+func (n *Noise) Parameters() NoiseParams {
+	n.mx.RLock()
+	defer n.mx.RUnlock()
+	return n.Params
+}
+
+// ChangeParameters changes the params; a new seed restarts the sequence
+func (n *Noise) ChangeParameters(params NoiseParams) {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	if params.Seed != n.Params.Seed {
+		n.rng.Seed(params.Seed)
+		n.pink = [7]float64{}
+		n.brown = 0
+	}
+	n.Params = params
+}
+
+func (n *Noise) Output(secs float64) float64 {
+	if !n.IsActive() {
+		return 0
+	}
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	return n.next()
+}
+
+func (n *Noise) Process(ctx *ProcessContext, out []float64) {
+	if !n.IsActive() {
+		zeroBuffer(out)
+		return
+	}
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	for i := range out {
+		out[i] = n.next()
+	}
+}
+
+// next computes the next sample; mx must be locked
+func (n *Noise) next() float64 {
+	params := n.Params
+	white := 2*n.rng.Float64() - 1
+	var v float64
+	switch params.Color {
+	case NoisePink:
+		// Paul Kellet's refined pink noise filter
+		b := &n.pink
+		b[0] = 0.99886*b[0] + white*0.0555179
+		b[1] = 0.99332*b[1] + white*0.0750759
+		b[2] = 0.96900*b[2] + white*0.1538520
+		b[3] = 0.86650*b[3] + white*0.3104856
+		b[4] = 0.55000*b[4] + white*0.5329522
+		b[5] = -0.7616*b[5] - white*0.0168980
+		v = (b[0] + b[1] + b[2] + b[3] + b[4] + b[5] + b[6] + white*0.5362) * 0.11
+		b[6] = white * 0.115926
+	case NoiseBrown:
+		// leaky integrator of white noise
+		n.brown = (n.brown + 0.02*white) / 1.02
+		v = n.brown * 3.5
+	default:
+		v = white
+	}
+	return params.Ampl * v
+}
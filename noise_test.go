@@ -0,0 +1,40 @@
+package wavx
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNoiseIsReproducible(t *testing.T) {
+	for _, color := range []NoiseColor{NoiseWhite, NoisePink, NoiseBrown} {
+		ctx := &ProcessContext{SampleRate: SampelRate44100}
+		a := make([]float64, 4096)
+		b := make([]float64, 4096)
+		NewNoise(color, 1, 42).Process(ctx, a)
+		NewNoise(color, 1, 42).Process(ctx, b)
+		var sum float64
+		for i := range a {
+			if a[i] != b[i] {
+				t.Fatalf("%s: sample %d differs: %f != %f", color, i, a[i], b[i])
+			}
+			if math.Abs(a[i]) > 1.5 {
+				t.Fatalf("%s: sample %d out of range: %f", color, i, a[i])
+			}
+			sum += a[i] * a[i]
+		}
+		if rms := math.Sqrt(sum / float64(len(a))); rms < 0.05 {
+			t.Errorf("%s: rms too low: %f", color, rms)
+		}
+	}
+}
+
+func TestNoiseReseed(t *testing.T) {
+	n := NewNoise(NoiseWhite, 1, 7)
+	first := n.Output(0)
+	n.Output(1)
+	n.Execute(Command{"seed": "8"})
+	n.Execute(Command{"seed": "7"})
+	if v := n.Output(2); v != first {
+		t.Fatalf("want restarted sequence %f, have %f", first, v)
+	}
+}
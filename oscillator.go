@@ -7,7 +7,6 @@ import (
 	"github.com/mazzegi/log"
 )
 
-//
 type StdOscillatorType string
 
 const (
@@ -15,33 +14,82 @@ const (
 	StdOscillatorSquare   StdOscillatorType = "square"
 	StdOscillatorSaw      StdOscillatorType = "saw"
 	StdOscillatorTriangle StdOscillatorType = "triangle"
+
+	// band-limited (PolyBLEP/PolyBLAMP) variants, which don't alias at high frequencies
+	StdOscillatorSquareBL   StdOscillatorType = "blsquare"
+	StdOscillatorSawBL      StdOscillatorType = "blsaw"
+	StdOscillatorTriangleBL StdOscillatorType = "bltriangle"
+
+	// sum of sines with a harmonic table, see additive.go
+	StdOscillatorAdditive StdOscillatorType = "additive"
 )
 
 const (
+	// StdOscillatorInputFreqMod expects a frequency deviation in Hz, which is added to Freq.
+	// Before the phase accumulator it was a phase offset (radians for sine, cycles for the other types);
+	// a sine phase modulation of amplitude a at rate r corresponds to a peak deviation of a*r Hz (2*pi*a*r for cycles).
 	StdOscillatorInputFreqMod = "frequency-modulation"
+	// StdOscillatorInputPulseWidthMod is added to the pulse width
+	StdOscillatorInputPulseWidthMod = "pulse-width-modulation"
+	// StdOscillatorInputSync resets the phase on each rising zero crossing of the master (hard sync)
+	StdOscillatorInputSync = "sync"
+	// StdOscillatorInputBrightnessMod is added to the brightness of the additive type
+	StdOscillatorInputBrightnessMod = "brightness-modulation"
+)
+
+const (
+	minPulseWidth = 0.01
+	maxPulseWidth = 0.99
 )
 
+// StdOscillatorParams holds the oscillator params; Glide is the time constant in seconds of the portamento towards Freq,
+// PulseWidth is the fraction of a cycle in which square waves are high. Rolloff and Brightness shape the harmonics of the additive type.
 type StdOscillatorParams struct {
-	Type      StdOscillatorType
-	Freq      float64
-	Ampl      float64
-	Overtones int
+	Type       StdOscillatorType
+	Freq       float64
+	Ampl       float64
+	Overtones  int
+	Glide      float64
+	PulseWidth float64
+	Rolloff    AdditiveRolloff
+	Brightness float64
 }
 
+// StdOscillator keeps its running phase, so frequency changes and modulation are continuous
+// and the output doesn't lose precision with growing time.
 type StdOscillator struct {
-	Params       StdOscillatorParams
-	FreqModInput Outputter
-	mx           sync.RWMutex
-	Muted        bool
+	Params             StdOscillatorParams
+	FreqModInput       Outputter
+	PulseWidthModInput Outputter
+	SyncInput          Outputter
+	BrightnessModInput Outputter
+	mx                 sync.RWMutex
+	Muted              bool
+	freqModBuf         []float64
+	pulseWidthModBuf   []float64
+	syncBuf            []float64
+	brightnessModBuf   []float64
+	harmonics          map[int]Harmonic
+	harmonicTable      []Harmonic
+	harmonicRolloff    AdditiveRolloff
+	phase              float64
+	inc                float64
+	freq               float64
+	clock              sampleClock
+	gliding            bool
+	lastSync           float64
 }
 
 func NewStdOscillator(typ StdOscillatorType, baseFreq float64, baseAmpl float64, overtones int) *StdOscillator {
 	return &StdOscillator{
 		Params: StdOscillatorParams{
-			Type:      typ,
-			Freq:      baseFreq,
-			Ampl:      baseAmpl,
-			Overtones: overtones,
+			Type:       typ,
+			Freq:       baseFreq,
+			Ampl:       baseAmpl,
+			Overtones:  overtones,
+			PulseWidth: 0.5,
+			Rolloff:    AdditiveRolloffLinear,
+			Brightness: 1,
 		},
 	}
 }
@@ -54,9 +102,25 @@ func (o *StdOscillator) Deactivate() {
 	o.Mute()
 }
 
+// Execute changes the params (e.g. freq:440) and the harmonics of the additive type (e.g. h3.ampl:0.5, h2.phase:0.25)
 func (o *StdOscillator) Execute(cmd Command) {
+	cmd, harmCmds, err := SplitIndexedCommand(cmd, "h")
+	if err != nil {
+		log.Warnf("std-oscillator: %v", err)
+		return
+	}
+	for n, harmCmd := range harmCmds {
+		err := o.ChangeHarmonic(n, harmCmd)
+		if err != nil {
+			log.Warnf("std-oscillator: %v", err)
+			return
+		}
+	}
+	if len(cmd) == 0 {
+		return
+	}
 	params := o.Parameters()
-	err := ApplyCommand(cmd, &params)
+	err = ApplyCommand(cmd, &params)
 	if err != nil {
 		log.Warnf("apply-command: %v", err)
 		return
@@ -67,6 +131,9 @@ func (o *StdOscillator) Execute(cmd Command) {
 func (o *StdOscillator) Inputs() []string {
 	return []string{
 		StdOscillatorInputFreqMod,
+		StdOscillatorInputPulseWidthMod,
+		StdOscillatorInputSync,
+		StdOscillatorInputBrightnessMod,
 	}
 }
 
@@ -74,6 +141,12 @@ func (o *StdOscillator) ConnectInput(input string, op Outputter) {
 	switch input {
 	case StdOscillatorInputFreqMod:
 		o.FreqModInput = op
+	case StdOscillatorInputPulseWidthMod:
+		o.PulseWidthModInput = op
+	case StdOscillatorInputSync:
+		o.SyncInput = op
+	case StdOscillatorInputBrightnessMod:
+		o.BrightnessModInput = op
 	default:
 		log.Warnf("no such input %q", input)
 	}
@@ -97,7 +170,6 @@ func (o *StdOscillator) Unmute() {
 	o.Muted = false
 }
 
-//
 func (o *StdOscillator) Parameters() StdOscillatorParams {
 	o.mx.RLock()
 	defer o.mx.RUnlock()
@@ -134,12 +206,68 @@ func (o *StdOscillator) ChangeOvertones(n int) {
 	o.Params.Overtones = n
 }
 
+// SetPhase sets the current phase in cycles
+func (o *StdOscillator) SetPhase(phase float64) {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+	o.phase = fract(phase)
+}
+
+func (o *StdOscillator) ChangePulseWidth(pw float64) {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+	o.Params.PulseWidth = pw
+}
+
 //
 
-func (o *StdOscillator) normalizedInPeriod(secs float64, freq, freqMod float64) float64 {
-	x := secs*freq + freqMod
-	x = x - math.Floor(x)
-	return x
+// sampleClock tracks the time between two samples of a phase accumulating oscillator
+type sampleClock struct {
+	lastSecs float64
+	started  bool
+}
+
+// elapsed returns the time since the previous sample. As the steps add up to the total time,
+// the phase doesn't drift, even if a single step is not exact for large times.
+func (c *sampleClock) elapsed(secs float64) float64 {
+	if !c.started {
+		c.started = true
+		c.lastSecs = secs
+		return 0
+	}
+	dt := secs - c.lastSecs
+	c.lastSecs = secs
+	if dt < 0 {
+		return 0
+	}
+	return dt
+}
+
+// advance moves the phase forward by dt seconds and returns the current frequency
+func (o *StdOscillator) advance(dt float64, params StdOscillatorParams, freqMod float64) float64 {
+	if !o.gliding || params.Glide <= 0 {
+		o.freq = params.Freq
+		o.gliding = true
+	} else {
+		o.freq += (params.Freq - o.freq) * (1 - math.Exp(-dt/params.Glide))
+	}
+	freq := o.freq + freqMod
+	o.inc = math.Abs(freq * dt)
+	o.phase += freq * dt
+	o.phase = fract(o.phase)
+	return freq
+}
+
+// sync resets the phase, if the master crossed zero upwards since the previous sample.
+// The phase starts from the (interpolated) moment of the crossing, which keeps the aliasing low.
+func (o *StdOscillator) sync(master float64, freq float64, dt float64) {
+	prev := o.lastSync
+	o.lastSync = master
+	if prev > 0 || master <= 0 {
+		return
+	}
+	after := master / (master - prev)
+	o.phase = fract(freq * dt * after)
 }
 
 func (o *StdOscillator) Output(secs float64) float64 {
@@ -147,15 +275,86 @@ func (o *StdOscillator) Output(secs float64) float64 {
 		return 0
 	}
 
-	var freqMod float64
+	var freqMod, pwMod, brightMod float64
 	if o.FreqModInput != nil {
 		freqMod = o.FreqModInput.Output(secs)
 	}
-	params := o.Parameters()
+	if o.PulseWidthModInput != nil {
+		pwMod = o.PulseWidthModInput.Output(secs)
+	}
+	if o.BrightnessModInput != nil {
+		brightMod = o.BrightnessModInput.Output(secs)
+	}
+	params, harmonics := o.snapshot()
+	dt := o.clock.elapsed(secs)
+	freq := o.advance(dt, params, freqMod)
+	if o.SyncInput != nil {
+		o.sync(o.SyncInput.Output(secs), freq, dt)
+	}
+	return o.output(params, harmonics, pwMod, brightMod)
+}
 
-	v := o.calc(secs, params.Type, params.Freq, freqMod, params.Ampl)
+func (o *StdOscillator) Process(ctx *ProcessContext, out []float64) {
+	if o.IsMuted() {
+		zeroBuffer(out)
+		return
+	}
+
+	var freqMod, pwMod, master, brightMod []float64
+	if o.FreqModInput != nil {
+		o.freqModBuf = growBuffer(o.freqModBuf, len(out))
+		freqMod = o.freqModBuf
+		ProcessBlock(ctx, o.FreqModInput, freqMod)
+	}
+	if o.PulseWidthModInput != nil {
+		o.pulseWidthModBuf = growBuffer(o.pulseWidthModBuf, len(out))
+		pwMod = o.pulseWidthModBuf
+		ProcessBlock(ctx, o.PulseWidthModInput, pwMod)
+	}
+	if o.SyncInput != nil {
+		o.syncBuf = growBuffer(o.syncBuf, len(out))
+		master = o.syncBuf
+		ProcessBlock(ctx, o.SyncInput, master)
+	}
+	if o.BrightnessModInput != nil {
+		o.brightnessModBuf = growBuffer(o.brightnessModBuf, len(out))
+		brightMod = o.brightnessModBuf
+		ProcessBlock(ctx, o.BrightnessModInput, brightMod)
+	}
+	params, harmonics := o.snapshot()
+	for i := range out {
+		var fm, pm, bm float64
+		if freqMod != nil {
+			fm = freqMod[i]
+		}
+		if pwMod != nil {
+			pm = pwMod[i]
+		}
+		if brightMod != nil {
+			bm = brightMod[i]
+		}
+		dt := o.clock.elapsed(ctx.Secs(i))
+		freq := o.advance(dt, params, fm)
+		if master != nil {
+			o.sync(master[i], freq, dt)
+		}
+		out[i] = o.output(params, harmonics, pm, bm)
+	}
+}
+
+func (o *StdOscillator) output(params StdOscillatorParams, harmonics []Harmonic, pwMod float64, brightMod float64) float64 {
+	if params.Type == StdOscillatorAdditive {
+		return o.additive(params, harmonics, params.Brightness+brightMod)
+	}
+	pw := params.PulseWidth + pwMod
+	if pw < minPulseWidth {
+		pw = minPulseWidth
+	} else if pw > maxPulseWidth {
+		pw = maxPulseWidth
+	}
+	v := o.calc(o.phase, o.inc, params.Type, params.Ampl, pw)
 	for i := 0; i < params.Overtones; i++ {
-		vo := o.calc(secs, params.Type, params.Freq*float64(i+2), 0, params.Ampl)
+		vo := o.calc(fract(o.phase*float64(i+2)), o.inc*float64(i+2), params.Type, params.Ampl, pw)
 		v += vo
 	}
 	if params.Overtones > 0 {
@@ -165,30 +364,83 @@ func (o *StdOscillator) Output(secs float64) float64 {
 	return v
 }
 
-func (o *StdOscillator) calc(secs float64, typ StdOscillatorType, freq, freqMod, ampl float64) float64 {
+// calc returns the waveform at the normalized phase x in [0, 1); inc is the phase increment per sample,
+// pw the pulse width of square waves
+func (o *StdOscillator) calc(x float64, inc float64, typ StdOscillatorType, ampl float64, pw float64) float64 {
 	var v float64
 	switch typ {
 	case StdOscillatorSine:
-		v = math.Sin(2.0*math.Pi*secs*freq + freqMod)
+		v = math.Sin(2.0 * math.Pi * x)
 	case StdOscillatorSquare:
-		x := o.normalizedInPeriod(secs, freq, freqMod)
-		if x > 0.5 {
+		if x > 1-pw {
 			v = 1
 		} else {
 			v = -1
 		}
 	case StdOscillatorSaw:
-		x := o.normalizedInPeriod(secs, freq, freqMod)
 		v = -1.0 + 2*x
 	case StdOscillatorTriangle:
-		x := o.normalizedInPeriod(secs, freq, freqMod)
 		if x < 0.5 {
 			v = 1 - x*4
 		} else {
 			v = -1 + (x-0.5)*4
 		}
+	case StdOscillatorSquareBL:
+		if x > 1-pw {
+			v = 1
+		} else {
+			v = -1
+		}
+		v += polyBLEP(fract(x+pw), inc) - polyBLEP(x, inc)
+	case StdOscillatorSawBL:
+		v = -1.0 + 2*x - polyBLEP(x, inc)
+	case StdOscillatorTriangleBL:
+		if x < 0.5 {
+			v = 1 - x*4
+		} else {
+			v = -1 + (x-0.5)*4
+		}
+		v -= 4 * inc * (polyBLAMP(x, inc) - polyBLAMP(fract(x+0.5), inc))
 	default:
 		v = 0
 	}
 	return ampl * v
 }
+
+func fract(x float64) float64 {
+	return x - math.Floor(x)
+}
+
+// polyBLEP returns the correction of a step of height 2 at phase 0 for the phase x and the increment inc
+func polyBLEP(x, inc float64) float64 {
+	if inc <= 0 {
+		return 0
+	}
+	switch {
+	case x < inc:
+		x /= inc
+		return x + x - x*x - 1
+	case x > 1-inc:
+		x = (x - 1) / inc
+		return x*x + x + x + 1
+	default:
+		return 0
+	}
+}
+
+// polyBLAMP returns the correction of a change of slope at phase 0 for the phase x and the increment inc
+func polyBLAMP(x, inc float64) float64 {
+	if inc <= 0 {
+		return 0
+	}
+	switch {
+	case x < inc:
+		x = x/inc - 1
+		return -x * x * x / 3
+	case x > 1-inc:
+		x = (x-1)/inc + 1
+		return x * x * x / 3
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,164 @@
+package wavx
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestStdOscillatorPhaseContinuity(t *testing.T) {
+	osc := NewStdOscillator(StdOscillatorSine, 440, 1, 0)
+	ctx := &ProcessContext{SampleRate: SampelRate44100}
+	buf := make([]float64, 256)
+	prev := 0.0
+	maxFreq := 880.0
+	// the step between two samples of a sine is bounded by its slope
+	maxStep := 2*math.Pi*maxFreq/SampelRate44100 + 1e-9
+	for n := 0; n < 100; n++ {
+		if n%10 == 5 {
+			osc.ChangeFreq(440 + 440*float64(n%20)/20)
+		}
+		osc.Process(ctx, buf)
+		for i, v := range buf {
+			if math.Abs(v-prev) > maxStep {
+				t.Fatalf("block %d, sample %d: jump from %f to %f", n, i, prev, v)
+			}
+			prev = v
+		}
+		ctx.Frame += uint64(len(buf))
+	}
+}
+
+func TestStdOscillatorLongRunning(t *testing.T) {
+	osc := NewStdOscillator(StdOscillatorSine, 440, 1, 0)
+	// start after 10 hours
+	ctx := &ProcessContext{SampleRate: SampelRate44100, Frame: 10 * 3600 * SampelRate44100}
+	buf := make([]float64, SampelRate44100)
+	osc.Process(ctx, buf)
+	for i, v := range buf {
+		want := math.Sin(2 * math.Pi * 440 * float64(i) / SampelRate44100)
+		if math.Abs(v-want) > 1e-6 {
+			t.Fatalf("sample %d: want %f, have %f", i, want, v)
+		}
+	}
+}
+
+func TestStdOscillatorGlide(t *testing.T) {
+	osc := NewStdOscillator(StdOscillatorSine, 100, 1, 0)
+	osc.Execute(Command{"glide": "0.1"})
+	ctx := &ProcessContext{SampleRate: SampelRate44100}
+	buf := make([]float64, SampelRate44100/10)
+	osc.Process(ctx, buf)
+	ctx.Frame += uint64(len(buf))
+
+	osc.ChangeFreq(200)
+	osc.Process(ctx, buf)
+	// after one time constant the frequency has moved by 1-1/e
+	want := 200 - 100/math.E
+	if math.Abs(osc.freq-want) > 0.5 {
+		t.Fatalf("want freq %f, have %f", want, osc.freq)
+	}
+}
+
+// aliasingDB returns the energy of all non-harmonic partials relative to the harmonic ones in dB
+func aliasingDB(typ StdOscillatorType, freq float64) float64 {
+	const sampleRate = 40000
+	const n = 4000 // 10 Hz bins
+	osc := NewStdOscillator(typ, freq, 1, 0)
+	buf := make([]float64, n)
+	osc.Process(&ProcessContext{SampleRate: sampleRate}, buf)
+
+	var harm, other float64
+	for k := 1; k < n/2; k++ {
+		var re, im float64
+		for i, v := range buf {
+			s, c := math.Sincos(2 * math.Pi * float64(k*i) / n)
+			re += v * c
+			im -= v * s
+		}
+		e := re*re + im*im
+		if (k*10)%int(freq) == 0 {
+			harm += e
+		} else {
+			other += e
+		}
+	}
+	return 10 * math.Log10(other/harm)
+}
+
+func TestBandLimitedOscillators(t *testing.T) {
+	tests := []struct {
+		naive, bl StdOscillatorType
+	}{
+		{StdOscillatorSaw, StdOscillatorSawBL},
+		{StdOscillatorSquare, StdOscillatorSquareBL},
+		{StdOscillatorTriangle, StdOscillatorTriangleBL},
+	}
+	for _, test := range tests {
+		naive := aliasingDB(test.naive, 2730)
+		bl := aliasingDB(test.bl, 2730)
+		if bl > naive-10 {
+			t.Errorf("%s: want at least 10 dB less aliasing than %s (%.1f dB), have %.1f dB", test.bl, test.naive, naive, bl)
+		}
+	}
+}
+
+func TestStdOscillatorPulseWidth(t *testing.T) {
+	for _, pw := range []float64{0.1, 0.25, 0.5, 0.8} {
+		osc := NewStdOscillator(StdOscillatorSquare, 100, 1, 0)
+		osc.Execute(Command{"pulsewidth": fmt.Sprintf("%f", pw)})
+		buf := make([]float64, 10000)
+		osc.Process(&ProcessContext{SampleRate: 10000}, buf)
+		var high int
+		for _, v := range buf {
+			if v > 0 {
+				high++
+			}
+		}
+		if duty := float64(high) / float64(len(buf)); math.Abs(duty-pw) > 0.01 {
+			t.Errorf("pulse width %f: have duty cycle %f", pw, duty)
+		}
+	}
+}
+
+func TestStdOscillatorPulseWidthModulation(t *testing.T) {
+	osc := NewStdOscillator(StdOscillatorSquareBL, 100, 1, 0)
+	mod := NewStdOscillator(StdOscillatorSine, 0, 0.3, 0)
+	osc.ConnectInput(StdOscillatorInputPulseWidthMod, mod)
+	// a sine of 0 Hz at a quarter cycle yields a constant modulation of +0.3
+	mod.phase = 0.25
+	buf := make([]float64, 10000)
+	osc.Process(&ProcessContext{SampleRate: 10000}, buf)
+	var high int
+	for _, v := range buf {
+		if v > 0 {
+			high++
+		}
+	}
+	if duty := float64(high) / float64(len(buf)); math.Abs(duty-0.8) > 0.01 {
+		t.Errorf("want duty cycle 0.8, have %f", duty)
+	}
+}
+
+func TestStdOscillatorSync(t *testing.T) {
+	const sampleRate = 48000
+	master := NewStdOscillator(StdOscillatorSine, 100, 1, 0)
+	slave := NewStdOscillator(StdOscillatorSaw, 330, 1, 0)
+	slave.ConnectInput(StdOscillatorInputSync, NewMemo(master))
+	buf := make([]float64, sampleRate/10)
+	slave.Process(&ProcessContext{SampleRate: sampleRate}, buf)
+
+	// the slave restarts with each cycle of the master
+	for i, v := range buf {
+		t0 := float64(i) / sampleRate
+		inCycle := t0 - math.Floor(t0*100+1e-9)/100
+		if inCycle < 1.5/sampleRate || inCycle > 0.01-1.5/sampleRate {
+			// skip the samples next to the crossings
+			continue
+		}
+		want := -1 + 2*fract(330*inCycle)
+		if math.Abs(v-want) > 1e-6 {
+			t.Fatalf("sample %d: want %f, have %f", i, want, v)
+		}
+	}
+}
@@ -2,110 +2,543 @@ package wavx
 
 import (
 	"math"
+	"math/rand"
 	"sync"
 
 	"github.com/mazzegi/log"
+	"github.com/pkg/errors"
 )
 
-type EnveloppedOscillator struct {
-	env *FixedSustainEnvelope
-	osc *StdOscillator
+// NoteReceiver is implemented by polyphonic components. Keys identify the notes, so that a note-off
+// releases the voice which plays the note.
+type NoteReceiver interface {
+	NoteOn(key int, freq float64)
+	NoteOff(key int)
+	AllNotesOff()
 }
 
+type VoiceSteal string
+
+const (
+	// VoiceStealOldest takes the voice which was started first
+	VoiceStealOldest VoiceSteal = "oldest"
+	// VoiceStealQuietest takes the voice with the lowest envelope level
+	VoiceStealQuietest VoiceSteal = "quietest"
+)
+
+// OscillatorPoolParams holds the params of all voices; attack, decay and release are in seconds,
+// Voices is the maximum number of voices playing at the same time.
+// Each note plays Unison sub-voices, which are detuned evenly by up to ±Detune semitones and spread
+// across the stereo field by Spread (0 = center, 1 = from left to right).
+type OscillatorPoolParams struct {
+	Type        StdOscillatorType
+	Ampl        float64
+	Overtones   int
+	Attack      float64
+	Decay       float64
+	Sustain     float64
+	Release     float64
+	Voices      int
+	Steal       VoiceSteal
+	Unison      int
+	Detune      float64
+	Spread      float64
+	RandomPhase bool
+}
+
+func (p OscillatorPoolParams) envelopeParams() EnvelopeParams {
+	return EnvelopeParams{
+		Attack:  p.Attack,
+		Decay:   p.Decay,
+		Sustain: p.Sustain,
+		Release: p.Release,
+	}
+}
+
+const (
+	// a released voice is free, when its output stayed below voiceSilence for voiceSilenceDuration seconds
+	voiceSilence         = 0.0001
+	voiceSilenceDuration = 0.05
+	// levelDecay is the decay of the peak follower per observed sample or block
+	levelDecay = 0.999
+)
+
+// stdVoice is the built-in voice of a StdOscillator and an Envelope
+type stdVoice struct {
+	osc     *StdOscillator
+	env     *Envelope
+	gateOn  bool
+	gateOff bool
+}
+
+func newStdVoice(params OscillatorPoolParams) *stdVoice {
+	return &stdVoice{
+		osc: NewStdOscillator(params.Type, 0, params.Ampl, params.Overtones),
+		env: NewEnvelope(params.envelopeParams()),
+	}
+}
+
+func (v *stdVoice) NoteOn(freq float64) {
+	v.osc.ChangeFreq(freq)
+	v.gateOn = true
+	v.gateOff = false
+}
+
+func (v *stdVoice) NoteOff() {
+	v.gateOff = true
+}
+
+func (v *stdVoice) SetPhase(phase float64) {
+	v.osc.SetPhase(phase)
+}
+
+func (v *stdVoice) gate(secs float64) {
+	if v.gateOn {
+		v.env.Start(secs)
+		v.gateOn = false
+	}
+	if v.gateOff {
+		v.env.Release(secs)
+		v.gateOff = false
+	}
+}
+
+func (v *stdVoice) Output(secs float64) float64 {
+	v.gate(secs)
+	if !v.env.IsActive() {
+		return 0
+	}
+	return v.osc.Output(secs) * v.env.Value(secs)
+}
+
+func (v *stdVoice) Process(ctx *ProcessContext, out []float64) {
+	v.gate(ctx.Secs(0))
+	if !v.env.IsActive() {
+		zeroBuffer(out)
+		return
+	}
+	v.osc.Process(ctx, out)
+	for i := range out {
+		out[i] *= v.env.Value(ctx.Secs(i))
+	}
+}
+
+type poolVoice struct {
+	unison      []Voice
+	key         int
+	seq         uint64
+	level       float64
+	playing     bool
+	started     bool
+	startedAt   float64
+	released    bool
+	oneShot     bool
+	silent      bool
+	silentSince float64
+}
+
+// isFree returns true, if the voice doesn't play
+func (v *poolVoice) isFree() bool {
+	return !v.playing
+}
+
+// begin marks the start of the output of v at secs
+func (v *poolVoice) begin(secs float64) {
+	if !v.started {
+		v.started = true
+		v.startedAt = secs
+	}
+}
+
+// observe updates the level and the playing state of v with the peak of the output from secs to endSecs.
+// loudSecs is the time of the last sample at or above voiceSilence, or negative, if there is none.
+func (v *poolVoice) observe(secs, endSecs float64, peak float64, loudSecs float64) {
+	v.level = math.Max(peak, v.level*levelDecay)
+	if !v.released {
+		v.silent = false
+		return
+	}
+	if !v.silent {
+		v.silent = true
+		v.silentSince = secs
+	}
+	// the silence starts after the last loud sample
+	if loudSecs >= v.silentSince {
+		v.silentSince = loudSecs
+	}
+	if endSecs-v.silentSince >= voiceSilenceDuration {
+		v.playing = false
+		v.level = 0
+	}
+}
+
+// OscillatorPool is a polyphonic synth. By default each voice is an enveloped StdOscillator, a voice template
+// replaces them by any other voice. The voices are summed, so Ampl is the amplitude of a single voice.
+// The unison sub-voices of a note are normalized to the loudness of a single sub-voice.
 type OscillatorPool struct {
 	sync.RWMutex
 	Activator
-	oscis         map[*EnveloppedOscillator]bool
-	defaultParams StdOscillatorParams
+	params     OscillatorPoolParams
+	template   VoiceTemplate
+	voices     []*poolVoice
+	seq        uint64
+	rnd        *rand.Rand
+	buf        []float64
+	bufL, bufR []float64
 }
 
-func NewOscillatorPool() *OscillatorPool {
-	return &OscillatorPool{
-		oscis: map[*EnveloppedOscillator]bool{},
-		defaultParams: StdOscillatorParams{
-			Type:      StdOscillatorSaw,
-			Ampl:      1.0,
-			Overtones: 4,
+func NewOscillatorPool(voices int) *OscillatorPool {
+	p := &OscillatorPool{
+		params: OscillatorPoolParams{
+			Type:      StdOscillatorSawBL,
+			Ampl:      0.3,
+			Overtones: 0,
+			Attack:    0.01,
+			Decay:     0.2,
+			Sustain:   0.7,
+			Release:   0.5,
+			Voices:    voices,
+			Steal:     VoiceStealOldest,
+			Unison:    1,
 		},
+		rnd: rand.New(rand.NewSource(1)),
 	}
+	if p.params.Voices < 1 {
+		p.params.Voices = 8
+	}
+	p.resize()
+	return p
+}
+
+// SetTemplate replaces all voices by voices of t
+func (p *OscillatorPool) SetTemplate(t VoiceTemplate) error {
+	p.Lock()
+	defer p.Unlock()
+	p.template = t
+	p.voices = nil
+	return p.resize()
 }
 
+// Execute changes the pool params (e.g. attack:0.1, voices:16, steal:quietest). A command with freq
+// plays a single note, which is released after attack and decay.
 func (p *OscillatorPool) Execute(cmd Command) {
-	params := p.defaultParams
-	err := ApplyCommand(cmd, &params)
+	var freq string
+	params := p.Parameters()
+	rest := Command{}
+	for k, v := range cmd {
+		if k == "freq" {
+			freq = v
+			continue
+		}
+		rest[k] = v
+	}
+	err := ApplyCommand(rest, &params)
 	if err != nil {
-		log.Warnf("apply command to std-oscillator-params")
+		log.Warnf("apply-command: %v", err)
+		return
+	}
+	err = p.ChangeParameters(params)
+	if err != nil {
+		log.Warnf("oscpool: %v", err)
+		return
+	}
+	if freq == "" {
+		return
+	}
+	cf, err := ParseChangeFloat(freq)
+	if err != nil {
+		log.Warnf("oscpool: invalid freq %q", freq)
 		return
 	}
-	osc := NewStdOscillator(params.Type, params.Freq, params.Ampl, params.Overtones)
-	env := NewFixedSustainEnvelope(
-		EnvelopeParams{
-			Attack:  0.8,
-			Decay:   0.2,
-			Sustain: 1.0,
-			Release: 1.0,
-		},
-		0.0,
-	)
 	p.Lock()
 	defer p.Unlock()
-	eosc := &EnveloppedOscillator{
-		env: env,
-		osc: osc,
+	v := p.allocate(-1)
+	p.start(v, -1, cf.Applied(0))
+	v.oneShot = true
+}
+
+func (p *OscillatorPool) Parameters() OscillatorPoolParams {
+	p.RLock()
+	defer p.RUnlock()
+	return p.params
+}
+
+// ChangeParameters applies params to all voices, including the playing ones. Oscillator and envelope params
+// only apply to the built-in voices.
+func (p *OscillatorPool) ChangeParameters(params OscillatorPoolParams) error {
+	p.Lock()
+	defer p.Unlock()
+	if params.Voices < 1 {
+		params.Voices = 1
+	}
+	if params.Unison < 1 {
+		params.Unison = 1
+	}
+	p.params = params
+	for _, v := range p.voices {
+		for _, uv := range v.unison {
+			sv, ok := uv.(*stdVoice)
+			if !ok {
+				continue
+			}
+			sv.env.params = params.envelopeParams()
+			oscParams := sv.osc.Parameters()
+			oscParams.Type = params.Type
+			oscParams.Ampl = params.Ampl
+			oscParams.Overtones = params.Overtones
+			sv.osc.ChangeParameters(oscParams)
+		}
+	}
+	return p.resize()
+}
+
+// resize adjusts the number of voices to params.Voices and the number of their sub-voices to params.Unison; lock must be held
+func (p *OscillatorPool) resize() error {
+	for len(p.voices) < p.params.Voices {
+		p.voices = append(p.voices, &poolVoice{
+			key: -1,
+		})
+	}
+	p.voices = p.voices[:p.params.Voices]
+	for _, v := range p.voices {
+		for len(v.unison) < p.params.Unison {
+			var voice Voice = newStdVoice(p.params)
+			if p.template != nil {
+				var err error
+				voice, err = p.template.NewVoice()
+				if err != nil {
+					return errors.Wrap(err, "new voice")
+				}
+			}
+			v.unison = append(v.unison, voice)
+		}
+		v.unison = v.unison[:p.params.Unison]
+	}
+	return nil
+}
+
+// unisonOffset returns the position of sub-voice i in [-1, 1]
+func (p *OscillatorPool) unisonOffset(i int) float64 {
+	if n := p.params.Unison; n > 1 {
+		return -1 + 2*float64(i)/float64(n-1)
+	}
+	return 0
+}
+
+// unisonGains returns the channel gains of sub-voice i, so a pool without spread sounds the same in mono and stereo
+func (p *OscillatorPool) unisonGains(i int) (left, right float64) {
+	return balanceGains(p.params.Spread * p.unisonOffset(i))
+}
+
+func (p *OscillatorPool) NoteOn(key int, freq float64) {
+	p.Lock()
+	defer p.Unlock()
+	p.start(p.allocate(key), key, freq)
+}
+
+func (p *OscillatorPool) NoteOff(key int) {
+	p.Lock()
+	defer p.Unlock()
+	for _, v := range p.voices {
+		if v.key == key && v.playing && !v.released {
+			p.release(v)
+		}
+	}
+}
+
+func (p *OscillatorPool) AllNotesOff() {
+	p.Lock()
+	defer p.Unlock()
+	for _, v := range p.voices {
+		if v.playing && !v.released {
+			p.release(v)
+		}
+	}
+}
+
+// allocate returns the voice for a new note: the voice which plays key already, a free voice or a stolen one; lock must be held
+func (p *OscillatorPool) allocate(key int) *poolVoice {
+	if key >= 0 {
+		for _, v := range p.voices {
+			if v.key == key && !v.isFree() {
+				return v
+			}
+		}
 	}
-	p.oscis[eosc] = true
+	for _, v := range p.voices {
+		if v.isFree() {
+			return v
+		}
+	}
+	// prefer released voices, as they are fading out anyway
+	var candidates []*poolVoice
+	for _, v := range p.voices {
+		if v.released {
+			candidates = append(candidates, v)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = p.voices
+	}
+	stolen := candidates[0]
+	for _, v := range candidates[1:] {
+		switch p.params.Steal {
+		case VoiceStealQuietest:
+			if v.level < stolen.level {
+				stolen = v
+			}
+		default:
+			if v.seq < stolen.seq {
+				stolen = v
+			}
+		}
+	}
+	log.Debugf("oscpool: steal voice of key %d", stolen.key)
+	return stolen
+}
 
-	doDetune := false
-	if doDetune {
-		i := 0.0
-		detuneStart := 2.0
-		for eosc := range p.oscis {
-			detune := detuneStart + i
-			params := eosc.osc.Parameters()
-			params.Freq += detune
-			eosc.osc.ChangeParameters(params)
-			i += 1.0
+// start starts the note on v; lock must be held
+func (p *OscillatorPool) start(v *poolVoice, key int, freq float64) {
+	p.seq++
+	v.key = key
+	v.seq = p.seq
+	v.playing = true
+	v.started = false
+	v.released = false
+	v.oneShot = false
+	v.silent = false
+	for i, uv := range v.unison {
+		if ps, ok := uv.(PhaseSetter); ok && p.params.RandomPhase {
+			ps.SetPhase(p.rnd.Float64())
 		}
+		uv.NoteOn(freq * math.Pow(2, p.params.Detune*p.unisonOffset(i)/12))
 	}
+}
 
-	log.Infof("added oscillator")
+// release releases the note on v; lock must be held
+func (p *OscillatorPool) release(v *poolVoice) {
+	v.released = true
+	for _, uv := range v.unison {
+		uv.NoteOff()
+	}
+}
+
+// releaseOneShot releases one-shot notes after attack and decay; lock must be held
+func (p *OscillatorPool) releaseOneShot(v *poolVoice, secs float64) {
+	if v.oneShot && v.started && !v.released && secs-v.startedAt >= p.params.Attack+p.params.Decay {
+		p.release(v)
+	}
 }
 
 func (p *OscillatorPool) Inputs() []string {
 	return []string{}
 }
 
-func (a *OscillatorPool) ConnectInput(input string, op Outputter) {
+func (p *OscillatorPool) ConnectInput(input string, op Outputter) {
 	log.Warnf("no inputs accepted")
 }
 
-func (a *OscillatorPool) Output(secs float64) float64 {
-	a.RLock()
-	defer a.RUnlock()
-	if len(a.oscis) == 0 {
-		return 0
+func (p *OscillatorPool) Output(secs float64) float64 {
+	l, r := p.OutputStereo(secs)
+	return (l + r) / 2
+}
+
+func (p *OscillatorPool) OutputStereo(secs float64) (left, right float64) {
+	p.Lock()
+	defer p.Unlock()
+	norm := 1 / math.Sqrt(float64(p.params.Unison))
+	for _, v := range p.voices {
+		if !v.playing {
+			continue
+		}
+		v.begin(secs)
+		p.releaseOneShot(v, secs)
+		var peak float64
+		for i, uv := range v.unison {
+			ov := uv.Output(secs) * norm
+			gl, gr := p.unisonGains(i)
+			left += gl * ov
+			right += gr * ov
+			peak = math.Max(peak, math.Abs(ov))
+		}
+		loudSecs := -1.0
+		if peak >= voiceSilence {
+			loudSecs = secs
+		}
+		v.observe(secs, secs, peak, loudSecs)
 	}
-	var sum float64
-	var cnt float64
+	return left, right
+}
 
-	for eosc := range a.oscis {
-		if !eosc.env.IsStarted() {
-			eosc.env.Start(secs)
+func (p *OscillatorPool) Process(ctx *ProcessContext, out []float64) {
+	p.bufL = growBuffer(p.bufL, len(out))
+	p.bufR = growBuffer(p.bufR, len(out))
+	p.ProcessStereo(ctx, p.bufL, p.bufR)
+	midBuffer(out, p.bufL, p.bufR)
+}
+
+func (p *OscillatorPool) ProcessStereo(ctx *ProcessContext, left, right []float64) {
+	zeroBuffer(left)
+	zeroBuffer(right)
+	p.Lock()
+	defer p.Unlock()
+	norm := 1 / math.Sqrt(float64(p.params.Unison))
+	n := len(left)
+	for _, v := range p.voices {
+		if !v.playing {
+			continue
 		}
+		v.begin(ctx.Secs(0))
+		// one-shot notes are released at the exact frame
+		split := p.oneShotFrame(v, ctx, n)
+		if split > 0 {
+			peak, loudSecs := p.renderVoice(ctx, v, left, right, 0, split, norm)
+			v.observe(ctx.Secs(0), ctx.Secs(split), peak, loudSecs)
+		}
+		if split < n {
+			p.release(v)
+			peak, loudSecs := p.renderVoice(ctx, v, left, right, split, n, norm)
+			v.observe(ctx.Secs(split), ctx.Secs(n), peak, loudSecs)
+		}
+	}
+}
 
-		ov := eosc.osc.Output(secs)
-		ev := eosc.env.Value(secs)
-		sum += ov * ev
-		cnt++
-		if !eosc.env.IsActive() {
-			delete(a.oscis, eosc)
-			log.Infof("removed oscillator")
+// oneShotFrame returns the frame of the block, at which the one-shot note of v is released, or n; lock must be held
+func (p *OscillatorPool) oneShotFrame(v *poolVoice, ctx *ProcessContext, n int) int {
+	if !v.oneShot || v.released {
+		return n
+	}
+	releaseSecs := v.startedAt + p.params.Attack + p.params.Decay
+	for i := 0; i < n; i++ {
+		if ctx.Secs(i) >= releaseSecs {
+			return i
 		}
 	}
+	return n
+}
 
-	var v float64
-	if cnt > 0 {
-		v = sum / math.Sqrt(cnt)
+// renderVoice adds the frames from to to of v to left and right. It returns the peak and the time of the last sample
+// at or above voiceSilence, or -1, if there is none; lock must be held.
+func (p *OscillatorPool) renderVoice(ctx *ProcessContext, v *poolVoice, left, right []float64, from, to int, norm float64) (peak float64, loudSecs float64) {
+	sub := &ProcessContext{SampleRate: ctx.SampleRate, Frame: ctx.Frame + uint64(from)}
+	p.buf = growBuffer(p.buf, to-from)
+	loud := -1
+	for i, uv := range v.unison {
+		ProcessBlock(sub, uv, p.buf)
+		gl, gr := p.unisonGains(i)
+		for j, ov := range p.buf {
+			ov *= norm
+			left[from+j] += gl * ov
+			right[from+j] += gr * ov
+			a := math.Abs(ov)
+			peak = math.Max(peak, a)
+			if a >= voiceSilence && j > loud {
+				loud = j
+			}
+		}
+	}
+	if loud < 0 {
+		return peak, -1
 	}
-	return v
+	return peak, sub.Secs(loud)
 }
@@ -0,0 +1,187 @@
+package wavx
+
+import (
+	"math"
+	"testing"
+)
+
+func poolRender(p *OscillatorPool, ctx *ProcessContext, n int) []float64 {
+	buf := make([]float64, n)
+	p.Process(ctx, buf)
+	ctx.Frame += uint64(n)
+	return buf
+}
+
+func playingKeys(p *OscillatorPool) map[int]bool {
+	keys := map[int]bool{}
+	for _, v := range p.voices {
+		if !v.isFree() && !v.released {
+			keys[v.key] = true
+		}
+	}
+	return keys
+}
+
+func TestOscillatorPoolNoteOff(t *testing.T) {
+	p := NewOscillatorPool(4)
+	p.Execute(Command{"attack": "0.01", "release": "0.05"})
+	ctx := &ProcessContext{SampleRate: 10000}
+	p.NoteOn(60, 261.63)
+	p.NoteOn(64, 329.63)
+	poolRender(p, ctx, 1000)
+	if keys := playingKeys(p); !keys[60] || !keys[64] || len(keys) != 2 {
+		t.Fatalf("want keys 60 and 64 playing, have %v", keys)
+	}
+
+	p.NoteOff(60)
+	poolRender(p, ctx, 1000)
+	if keys := playingKeys(p); keys[60] || !keys[64] {
+		t.Fatalf("want key 64 playing, have %v", keys)
+	}
+
+	p.AllNotesOff()
+	poolRender(p, ctx, 1000)
+	buf := poolRender(p, ctx, 100)
+	for i, v := range buf {
+		if v != 0 {
+			t.Fatalf("sample %d: want silence, have %f", i, v)
+		}
+	}
+}
+
+func TestOscillatorPoolStealOldest(t *testing.T) {
+	p := NewOscillatorPool(2)
+	ctx := &ProcessContext{SampleRate: 10000}
+	for key := 1; key <= 3; key++ {
+		p.NoteOn(key, 100*float64(key))
+		poolRender(p, ctx, 100)
+	}
+	if keys := playingKeys(p); keys[1] || !keys[2] || !keys[3] {
+		t.Fatalf("want keys 2 and 3 playing, have %v", keys)
+	}
+}
+
+func TestOscillatorPoolStealQuietest(t *testing.T) {
+	p := NewOscillatorPool(2)
+	p.Execute(Command{"steal": string(VoiceStealQuietest), "attack": "1"})
+	ctx := &ProcessContext{SampleRate: 10000}
+	p.NoteOn(1, 100)
+	poolRender(p, ctx, 5000)
+	// key 2 is still in its attack and quieter than key 1
+	p.NoteOn(2, 200)
+	poolRender(p, ctx, 1000)
+	p.NoteOn(3, 300)
+	poolRender(p, ctx, 100)
+	if keys := playingKeys(p); !keys[1] || keys[2] || !keys[3] {
+		t.Fatalf("want keys 1 and 3 playing, have %v", keys)
+	}
+}
+
+func TestOscillatorPoolOneShot(t *testing.T) {
+	p := NewOscillatorPool(4)
+	p.Execute(Command{"attack": "0.01", "decay": "0.01", "release": "0.01"})
+	p.Execute(Command{"freq": "440"})
+	ctx := &ProcessContext{SampleRate: 10000}
+	poolRender(p, ctx, 1000)
+	for _, v := range p.voices {
+		if !v.isFree() {
+			t.Fatalf("one-shot note is still playing")
+		}
+	}
+}
+
+func TestOscillatorPoolOneShotBlocks(t *testing.T) {
+	// the one-shot note ends at the same time in small blocks and per sample
+	for _, block := range []int{1, 64, 100} {
+		p := NewOscillatorPool(2)
+		p.Execute(Command{"attack": "0.01", "decay": "0.01", "release": "0.01"})
+		p.Execute(Command{"freq": "440"})
+		ctx := &ProcessContext{SampleRate: 10000}
+		for n := 0; n < 1000; n += block {
+			if block == 1 {
+				p.Output(ctx.Secs(0))
+			} else {
+				p.Process(ctx, make([]float64, block))
+			}
+			ctx.Frame += uint64(block)
+		}
+		for _, v := range p.voices {
+			if !v.isFree() {
+				t.Fatalf("blocks of %d: one-shot note is still playing", block)
+			}
+		}
+	}
+}
+
+type fmTemplate struct{}
+
+func (fmTemplate) NewVoice() (Voice, error) {
+	return NewFMVoice(1, 0, 1), nil
+}
+
+func TestOscillatorPoolTemplate(t *testing.T) {
+	p := NewOscillatorPool(2)
+	err := p.SetTemplate(fmTemplate{})
+	if err != nil {
+		t.Fatalf("set template: %v", err)
+	}
+	ctx := &ProcessContext{SampleRate: 10000}
+	p.NoteOn(1, 100)
+	p.NoteOn(2, 200)
+	poolRender(p, ctx, 100)
+	freqs := map[float64]bool{}
+	for _, v := range p.voices {
+		freqs[v.unison[0].(*FMVoice).Parameters().Freq] = true
+	}
+	if !freqs[100] || !freqs[200] {
+		t.Fatalf("want voices of 100 Hz and 200 Hz, have %v", freqs)
+	}
+
+	p.AllNotesOff()
+	// release of 0.3 s plus the silence detection
+	poolRender(p, ctx, 4000)
+	if keys := playingKeys(p); len(keys) != 0 {
+		t.Fatalf("want no keys playing, have %v", keys)
+	}
+	for _, v := range p.voices {
+		if v.playing {
+			t.Fatalf("voice of key %d is still playing", v.key)
+		}
+	}
+}
+
+func TestOscillatorPoolUnison(t *testing.T) {
+	p := NewOscillatorPool(2)
+	p.Execute(Command{"unison": "3", "detune": "1", "spread": "1", "randomphase": "true"})
+	p.NoteOn(1, 440)
+	v := p.voices[0]
+	if len(v.unison) != 3 {
+		t.Fatalf("want 3 sub-voices, have %d", len(v.unison))
+	}
+	phases := map[float64]bool{}
+	for i, want := range []float64{440 * math.Pow(2, -1.0/12), 440, 440 * math.Pow(2, 1.0/12)} {
+		osc := v.unison[i].(*stdVoice).osc
+		if have := osc.Parameters().Freq; math.Abs(have-want) > 1e-9 {
+			t.Errorf("sub-voice %d: want freq %f, have %f", i, want, have)
+		}
+		phases[osc.phase] = true
+	}
+	if len(phases) != 3 {
+		t.Errorf("want random phases, have %v", phases)
+	}
+
+	ctx := &ProcessContext{SampleRate: 10000}
+	left := make([]float64, 1000)
+	right := make([]float64, 1000)
+	p.ProcessStereo(ctx, left, right)
+	if rms(left) == 0 || rms(right) == 0 {
+		t.Fatalf("want both channels, have rms %f, %f", rms(left), rms(right))
+	}
+	var diff float64
+	for i := range left {
+		diff = math.Max(diff, math.Abs(left[i]-right[i]))
+	}
+	if diff < 0.01 {
+		t.Fatalf("want different channels with spread")
+	}
+}
@@ -0,0 +1,189 @@
+package wavx
+
+import (
+	"math"
+	"sync"
+
+	"github.com/mazzegi/log"
+)
+
+type PanLaw string
+
+const (
+	// PanLawLinear attenuates the center by 6 dB
+	PanLawLinear PanLaw = "linear"
+	// PanLawConstantPower attenuates the center by 3 dB, so the loudness stays the same across the field
+	PanLawConstantPower PanLaw = "constant-power"
+	// PanLawCompromise attenuates the center by 4.5 dB
+	PanLawCompromise PanLaw = "compromise"
+)
+
+// PanParams holds the pan params; Pan ranges from -1 (left) to 1 (right)
+type PanParams struct {
+	Pan float64
+	Law PanLaw
+}
+
+const (
+	PanInputSignal        = "signal"
+	PanInputPanModulation = "pan-modulation"
+)
+
+// Pan places a signal in the stereo field. Mono signals are panned according to the law, stereo signals are balanced,
+// so that a centered stereo signal keeps its level.
+type Pan struct {
+	mx          sync.RWMutex
+	Params      PanParams
+	inputSignal Outputter
+	inputPanMod Outputter
+	bufL, bufR  []float64
+	panModBuf   []float64
+	Activator
+}
+
+func NewPan(pan float64, law PanLaw) *Pan {
+	return &Pan{
+		Params: PanParams{
+			Pan: pan,
+			Law: law,
+		},
+	}
+}
+
+func (p *Pan) Inputs() []string {
+	return []string{
+		PanInputSignal,
+		PanInputPanModulation,
+	}
+}
+
+func (p *Pan) ConnectInput(input string, op Outputter) {
+	switch input {
+	case PanInputSignal:
+		p.inputSignal = op
+	case PanInputPanModulation:
+		p.inputPanMod = op
+	default:
+		log.Warnf("no such input %q", input)
+	}
+}
+
+func (p *Pan) Execute(cmd Command) {
+	params := p.Parameters()
+	err := ApplyCommand(cmd, &params)
+	if err != nil {
+		log.Warnf("apply-command: %v", err)
+		return
+	}
+	p.ChangeParameters(params)
+}
+
+func (p *Pan) Parameters() PanParams {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+	return p.Params
+}
+
+func (p *Pan) ChangeParameters(params PanParams) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	p.Params = params
+}
+
+// PanGains returns the gains of the left and the right channel for pan according to law
+func PanGains(pan float64, law PanLaw) (left, right float64) {
+	if pan < -1 {
+		pan = -1
+	} else if pan > 1 {
+		pan = 1
+	}
+	linL, linR := (1-pan)/2, (1+pan)/2
+	theta := (pan + 1) * math.Pi / 4
+	cpL, cpR := math.Cos(theta), math.Sin(theta)
+	switch law {
+	case PanLawLinear:
+		return linL, linR
+	case PanLawCompromise:
+		return math.Sqrt(linL * cpL), math.Sqrt(linR * cpR)
+	default:
+		return cpL, cpR
+	}
+}
+
+// balanceGains returns the channel gains for pos in [-1, 1]. The center keeps the full level on both channels,
+// the opposite channel is attenuated towards the sides.
+func balanceGains(pos float64) (left, right float64) {
+	left, right = 1, 1
+	if pos > 0 {
+		left -= pos
+	} else {
+		right += pos
+	}
+	return left, right
+}
+
+// gains returns the channel gains for pan; stereo signals are balanced
+func (p *Pan) gains(pan float64, law PanLaw, stereo bool) (left, right float64) {
+	if !stereo {
+		return PanGains(pan, law)
+	}
+	return balanceGains(math.Max(-1, math.Min(pan, 1)))
+}
+
+func (p *Pan) Output(secs float64) float64 {
+	l, r := p.OutputStereo(secs)
+	return (l + r) / 2
+}
+
+func (p *Pan) OutputStereo(secs float64) (left, right float64) {
+	if p.inputSignal == nil {
+		return 0, 0
+	}
+	l, r := OutputStereo(p.inputSignal, secs)
+	if !p.IsActive() {
+		return l, r
+	}
+	params := p.Parameters()
+	pan := params.Pan
+	if p.inputPanMod != nil {
+		pan += p.inputPanMod.Output(secs)
+	}
+	gl, gr := p.gains(pan, params.Law, carriesStereo(p.inputSignal))
+	return gl * l, gr * r
+}
+
+func (p *Pan) Process(ctx *ProcessContext, out []float64) {
+	p.bufL = growBuffer(p.bufL, len(out))
+	p.bufR = growBuffer(p.bufR, len(out))
+	p.ProcessStereo(ctx, p.bufL, p.bufR)
+	midBuffer(out, p.bufL, p.bufR)
+}
+
+func (p *Pan) ProcessStereo(ctx *ProcessContext, left, right []float64) {
+	if p.inputSignal == nil {
+		zeroBuffer(left)
+		zeroBuffer(right)
+		return
+	}
+	ProcessStereoBlock(ctx, p.inputSignal, left, right)
+	if !p.IsActive() {
+		return
+	}
+	params := p.Parameters()
+	stereo := carriesStereo(p.inputSignal)
+	if p.inputPanMod == nil {
+		gl, gr := p.gains(params.Pan, params.Law, stereo)
+		for i := range left {
+			left[i] *= gl
+			right[i] *= gr
+		}
+		return
+	}
+	p.panModBuf = growBuffer(p.panModBuf, len(left))
+	ProcessBlock(ctx, p.inputPanMod, p.panModBuf)
+	for i := range left {
+		gl, gr := p.gains(params.Pan+p.panModBuf[i], params.Law, stereo)
+		left[i] *= gl
+		right[i] *= gr
+	}
+}
@@ -0,0 +1,75 @@
+package wavx
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPanGains(t *testing.T) {
+	tests := []struct {
+		law          PanLaw
+		pan          float64
+		wantL, wantR float64
+	}{
+		{PanLawLinear, 0, 0.5, 0.5},
+		{PanLawLinear, -1, 1, 0},
+		{PanLawConstantPower, 0, math.Sqrt(0.5), math.Sqrt(0.5)},
+		{PanLawConstantPower, 1, 0, 1},
+		{PanLawCompromise, 0, math.Pow(0.5, 0.75), math.Pow(0.5, 0.75)},
+	}
+	for _, test := range tests {
+		l, r := PanGains(test.pan, test.law)
+		if math.Abs(l-test.wantL) > 1e-3 || math.Abs(r-test.wantR) > 1e-3 {
+			t.Errorf("%s at %.1f: want (%.4f, %.4f), have (%.4f, %.4f)", test.law, test.pan, test.wantL, test.wantR, l, r)
+		}
+	}
+}
+
+func TestStereoRender(t *testing.T) {
+	left := NewPan(-1, PanLawConstantPower)
+	left.ConnectInput(PanInputSignal, NewStdOscillator(StdOscillatorSquare, 100, 1, 0))
+	adder := NewAdder()
+	adder.ConnectInput(AdderInput, left)
+	adder.ConnectInput(AdderInput, NewStdOscillator(StdOscillatorSquare, 100, 1, 0))
+
+	synth := NewSynthesizer(SampelRate44100, adder, nil)
+	buf := make([]float64, 2*64)
+	synth.Render(buf)
+	for i := 0; i < 64; i++ {
+		l, r := buf[2*i], buf[2*i+1]
+		// hard left square plus centered square
+		if math.Abs(l-2*r) > 1e-9 {
+			t.Fatalf("frame %d: want left twice right, have (%f, %f)", i, l, r)
+		}
+	}
+}
+
+func TestPanBalancesStereo(t *testing.T) {
+	ctx := &ProcessContext{SampleRate: SampelRate44100}
+	left := make([]float64, 64)
+	right := make([]float64, 64)
+
+	// a hard left signal keeps its level at the center of a second pan
+	hardLeft := NewPan(-1, PanLawConstantPower)
+	hardLeft.ConnectInput(PanInputSignal, NewStdOscillator(StdOscillatorSquare, 100, 1, 0))
+	center := NewPan(0, PanLawConstantPower)
+	center.ConnectInput(PanInputSignal, hardLeft)
+	center.ProcessStereo(ctx, left, right)
+	for i := range left {
+		if math.Abs(math.Abs(left[i])-1) > 1e-9 || right[i] != 0 {
+			t.Fatalf("stereo, frame %d: want (±1, 0), have (%f, %f)", i, left[i], right[i])
+		}
+	}
+
+	// an adder of mono signals is still panned according to the law
+	adder := NewAdder()
+	adder.ConnectInput(AdderInput, NewStdOscillator(StdOscillatorSquare, 100, 1, 0))
+	mono := NewPan(0, PanLawConstantPower)
+	mono.ConnectInput(PanInputSignal, NewMemo(adder))
+	mono.ProcessStereo(ctx, left, right)
+	for i := range left {
+		if math.Abs(math.Abs(left[i])-math.Sqrt(0.5)) > 1e-9 {
+			t.Fatalf("mono, frame %d: want ±%f, have %f", i, math.Sqrt(0.5), left[i])
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package wavx
+
+import (
+	"math"
+	"sync"
+
+	"github.com/mazzegi/log"
+)
+
+const (
+	PhaserInputSignal = "signal"
+	// PhaserInputFreqModulation is in octaves, so +1 doubles the center frequency
+	PhaserInputFreqModulation = "frequency-modulation"
+)
+
+const (
+	maxPhaserStages = 12
+	minPhaserFreq   = 20.0
+)
+
+// PhaserParams holds the phaser params. Freq is the center of the sweep in Hz, Depth the sweep in octaves
+// and Rate is in Hz. Stages is the number of allpasses, an even number from 2 to 12, as each pair adds a notch.
+// Feedback ranges from -1 to 1, Mix from 0 (dry) to 1 (wet); the notches are deepest at a Mix of 0.5.
+type PhaserParams struct {
+	Freq     float64
+	Depth    float64
+	Rate     float64
+	Stages   int
+	Feedback float64
+	Mix      float64
+}
+
+// phaserStage is a first order allpass in transposed direct form
+type phaserStage struct {
+	z float64
+}
+
+func (s *phaserStage) next(x, a float64) float64 {
+	y := a*x + s.z
+	s.z = x - a*y
+	return y
+}
+
+// Phaser sweeps the notches of a chain of allpasses. The per-sample Output assumes SampelRate44100,
+// unless the sample rate is set by SetSampleRate or by a previous Process.
+type Phaser struct {
+	mx           sync.RWMutex
+	Params       PhaserParams
+	inputSignal  Outputter
+	inputFreqMod Outputter
+	freqModBuf   []float64
+	sampleRate   int
+	stages       [maxPhaserStages]phaserStage
+	phase        float64
+	clock        sampleClock
+	last         float64
+	Activator
+}
+
+// NewPhaser creates a phaser of stages allpasses with a feedback of 0.5, mixed half wet
+func NewPhaser(freq float64, depth float64, rate float64, stages int) *Phaser {
+	return &Phaser{
+		Params: PhaserParams{
+			Freq:     freq,
+			Depth:    depth,
+			Rate:     rate,
+			Stages:   phaserStages(stages),
+			Feedback: 0.5,
+			Mix:      0.5,
+		},
+		sampleRate: SampelRate44100,
+	}
+}
+
+func (p *Phaser) Inputs() []string {
+	return []string{
+		PhaserInputSignal,
+		PhaserInputFreqModulation,
+	}
+}
+
+func (p *Phaser) ConnectInput(input string, op Outputter) {
+	switch input {
+	case PhaserInputSignal:
+		p.inputSignal = op
+	case PhaserInputFreqModulation:
+		p.inputFreqMod = op
+	default:
+		log.Warnf("no such input %q", input)
+	}
+}
+
+func (p *Phaser) Execute(cmd Command) {
+	params := p.Parameters()
+	err := ApplyCommand(cmd, &params)
+	if err != nil {
+		log.Warnf("apply-command: %v", err)
+		return
+	}
+	p.ChangeParameters(params)
+}
+
+func (p *Phaser) Parameters() PhaserParams {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+	return p.Params
+}
+
+func (p *Phaser) ChangeParameters(params PhaserParams) {
+	params.Stages = phaserStages(params.Stages)
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	p.Params = params
+}
+
+func (p *Phaser) SetSampleRate(sampleRate int) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	p.sampleRate = sampleRate
+}
+
+func (p *Phaser) Output(secs float64) float64 {
+	if p.inputSignal == nil {
+		return 0
+	}
+	v := p.inputSignal.Output(secs)
+	if !p.IsActive() {
+		return v
+	}
+	var freqMod float64
+	if p.inputFreqMod != nil {
+		freqMod = p.inputFreqMod.Output(secs)
+	}
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	return p.next(secs, v, p.Params, freqMod)
+}
+
+func (p *Phaser) Process(ctx *ProcessContext, out []float64) {
+	if p.inputSignal == nil {
+		zeroBuffer(out)
+		return
+	}
+	ProcessBlock(ctx, p.inputSignal, out)
+	if !p.IsActive() {
+		return
+	}
+	var freqMod []float64
+	if p.inputFreqMod != nil {
+		p.freqModBuf = growBuffer(p.freqModBuf, len(out))
+		freqMod = p.freqModBuf
+		ProcessBlock(ctx, p.inputFreqMod, freqMod)
+	}
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	p.sampleRate = ctx.SampleRate
+	params := p.Params
+	for i, v := range out {
+		var fm float64
+		if freqMod != nil {
+			fm = freqMod[i]
+		}
+		out[i] = p.next(ctx.Secs(i), v, params, fm)
+	}
+}
+
+// phaserStages clamps n to [2, maxPhaserStages] and rounds it down to an even number of stages
+func phaserStages(n int) int {
+	if n < 2 {
+		return 2
+	} else if n > maxPhaserStages {
+		return maxPhaserStages
+	}
+	return n - n%2
+}
+
+// phaserCoefficient returns the allpass coefficient, which shifts freq by 90 degrees
+func phaserCoefficient(freq float64, sampleRate int) float64 {
+	freq = math.Max(minPhaserFreq, math.Min(freq, 0.49*float64(sampleRate)))
+	t := math.Tan(math.Pi * freq / float64(sampleRate))
+	return (t - 1) / (t + 1)
+}
+
+// next computes the next sample; mx must be locked
+func (p *Phaser) next(secs float64, v float64, params PhaserParams, freqMod float64) float64 {
+	p.phase = fract(p.phase + params.Rate*p.clock.elapsed(secs))
+	sweep := params.Depth*math.Sin(2*math.Pi*p.phase) + freqMod
+	a := phaserCoefficient(params.Freq*math.Pow(2, sweep), p.sampleRate)
+
+	n := phaserStages(params.Stages)
+	fb := math.Max(-maxModFeedback, math.Min(params.Feedback, maxModFeedback))
+	wet := v + fb*p.last
+	for i := 0; i < n; i++ {
+		wet = p.stages[i].next(wet, a)
+	}
+	p.last = wet
+
+	mix := clamp01(params.Mix)
+	return (1-mix)*v + mix*wet
+}
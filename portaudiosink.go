@@ -0,0 +1,74 @@
+package wavx
+
+import (
+	"github.com/gordonklaus/portaudio"
+	"github.com/mazzegi/log"
+	"github.com/pkg/errors"
+)
+
+// PortaudioSink plays the samples on the default output device
+type PortaudioSink struct {
+	stream *portaudio.Stream
+	buf    []float64
+}
+
+func NewPortaudioSink() *PortaudioSink {
+	return &PortaudioSink{}
+}
+
+func (s *PortaudioSink) Open(sampleRate int, channels int, render RenderFunc) error {
+	err := portaudio.Initialize()
+	if err != nil {
+		return errors.Wrap(err, "portaudio: initialize")
+	}
+
+	s.stream, err = portaudio.OpenDefaultStream(0, channels, float64(sampleRate), 0, func(out []float32) {
+		if cap(s.buf) < len(out) {
+			s.buf = make([]float64, len(out))
+		}
+		buf := s.buf[:len(out)]
+		render(buf)
+		for i, v := range buf {
+			out[i] = float32(v)
+		}
+	})
+	if err != nil {
+		s.Close()
+		return errors.Wrap(err, "portaudio: open-default-stream")
+	}
+	return nil
+}
+
+func (s *PortaudioSink) Close() error {
+	if s.stream != nil {
+		err := s.Stop()
+		if err != nil {
+			log.Errorf("portaudio: stop-stream: %v", err)
+		}
+		err = s.stream.Close()
+		if err != nil {
+			log.Errorf("portaudio: close-stream: %v", err)
+		}
+		s.stream = nil
+	}
+
+	err := portaudio.Terminate()
+	if err != nil {
+		return errors.Wrap(err, "portaudio: terminate")
+	}
+	return nil
+}
+
+func (s *PortaudioSink) Start() error {
+	if s.stream == nil {
+		return errors.Errorf("stream is not open")
+	}
+	return s.stream.Start()
+}
+
+func (s *PortaudioSink) Stop() error {
+	if s.stream == nil {
+		return errors.Errorf("stream is not open")
+	}
+	return s.stream.Stop()
+}
@@ -1,46 +1,225 @@
 package wavx
 
+import (
+	"math"
+	"sync"
+
+	"github.com/mazzegi/log"
+)
+
+const (
+	ReverbInputSignal = "signal"
+)
+
+// ReverbParams holds the reverb params; RoomSize, Damping, Width and Mix range from 0 to 1, PreDelay is in ms
+type ReverbParams struct {
+	RoomSize float64
+	Damping  float64
+	Width    float64
+	PreDelay float64
+	Mix      float64
+}
+
+// the freeverb tunings in samples at 44.1 kHz; the right channel is detuned by reverbStereoSpread
+var (
+	reverbCombTunings    = []float64{1116, 1188, 1277, 1356, 1422, 1491, 1557, 1617}
+	reverbAllPassTunings = []float64{556, 441, 341, 225}
+)
+
+const (
+	reverbStereoSpread = 23
+	reverbAllPassGain  = 0.5
+	// reverbInputGain keeps the sum of the combs in range
+	reverbInputGain = 0.015
+	reverbWetGain   = 3
+	// the room size maps to the comb feedback in [reverbRoomOffset, reverbRoomOffset+reverbRoomScale]
+	reverbRoomScale  = 0.28
+	reverbRoomOffset = 0.7
+	reverbDampScale  = 0.4
+	maxPreDelaySecs  = 1.0
+)
+
+type reverbChannel struct {
+	combs     []*CombFilter
+	allPasses []*AllPassFilter
+}
+
+func newReverbChannel(sampleRate float64, spread float64) reverbChannel {
+	msecs := func(samples float64) float64 {
+		return (samples + spread) * 1000 / SampelRate44100
+	}
+	var c reverbChannel
+	for _, t := range reverbCombTunings {
+		c.combs = append(c.combs, NewCombFilter(0, msecs(t), sampleRate))
+	}
+	for _, t := range reverbAllPassTunings {
+		c.allPasses = append(c.allPasses, NewAllPassFilter(reverbAllPassGain, msecs(t), sampleRate))
+	}
+	return c
+}
+
+func (c *reverbChannel) next(x float64, feedback, damping float64) float64 {
+	var sum float64
+	for _, comb := range c.combs {
+		comb.Gain = feedback
+		comb.Damping = damping
+		sum += comb.Next(x)
+	}
+	for _, ap := range c.allPasses {
+		sum = ap.Next(sum)
+	}
+	return sum
+}
+
+// Reverb is a freeverb style stereo reverb of eight lowpass damped combs and four allpasses per channel.
+// The per-sample Output assumes the sample rate passed to NewReverb, unless it is changed by a Process.
 type Reverb struct {
+	mx          sync.RWMutex
+	Params      ReverbParams
 	inputSignal Outputter
-	comb1       *CombFilter
-	comb2       *CombFilter
-	comb3       *CombFilter
-	comb4       *CombFilter
-	allPass1    *AllPassFilter
-	allPass2    *AllPassFilter
+	sampleRate  int
+	left, right reverbChannel
+	preDelay    *DelayLine
+	outL, outR  []float64
+	Activator
 }
 
+// NewReverb creates a reverb with a medium room, mixed half wet
 func NewReverb(sampleRate float64) *Reverb {
-	delay := 78.9
-	decay := 0.45
-	return &Reverb{
-		comb1:    NewCombFilter(decay, delay, sampleRate),
-		comb2:    NewCombFilter(decay-0.1313, delay-11.73, sampleRate),
-		comb3:    NewCombFilter(decay-0.2743, delay+19.31, sampleRate),
-		comb4:    NewCombFilter(decay-0.31, delay-7.79, sampleRate),
-		allPass1: NewAllPassFilter(0.13, 89.27, sampleRate),
-		allPass2: NewAllPassFilter(0.13, 89.27, sampleRate),
+	r := &Reverb{
+		Params: ReverbParams{
+			RoomSize: 0.5,
+			Damping:  0.5,
+			Width:    1,
+			Mix:      0.5,
+		},
 	}
+	r.setSampleRate(int(sampleRate))
+	return r
 }
 
-func (d *Reverb) ConnectInput(op Outputter) {
-	d.inputSignal = op
+func (r *Reverb) Inputs() []string {
+	return []string{
+		ReverbInputSignal,
+	}
+}
 
+func (r *Reverb) ConnectInput(input string, op Outputter) {
+	switch input {
+	case ReverbInputSignal:
+		r.inputSignal = op
+	default:
+		log.Warnf("no such input %q", input)
+	}
 }
 
-func (d *Reverb) Output(secs float64) float64 {
-	if d.inputSignal == nil {
-		return 0
+func (r *Reverb) Execute(cmd Command) {
+	params := r.Parameters()
+	err := ApplyCommand(cmd, &params)
+	if err != nil {
+		log.Warnf("apply-command: %v", err)
+		return
 	}
-	newVal := d.inputSignal.Output(secs)
-	c1 := d.comb1.Next(newVal)
-	c2 := d.comb2.Next(newVal)
-	c3 := d.comb3.Next(newVal)
-	c4 := d.comb4.Next(newVal)
-	c := (c1 + c2 + c3 + c4) / 4
+	r.ChangeParameters(params)
+}
 
-	c = d.allPass1.Next(c)
-	c = d.allPass2.Next(c)
+func (r *Reverb) Parameters() ReverbParams {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+	return r.Params
+}
 
-	return c
+func (r *Reverb) ChangeParameters(params ReverbParams) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.Params = params
+}
+
+func (r *Reverb) SetSampleRate(sampleRate int) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.setSampleRate(sampleRate)
+}
+
+// setSampleRate rebuilds the filters, if the sample rate changes; mx must be locked
+func (r *Reverb) setSampleRate(sampleRate int) {
+	if sampleRate == r.sampleRate {
+		return
+	}
+	r.sampleRate = sampleRate
+	r.left = newReverbChannel(float64(sampleRate), 0)
+	r.right = newReverbChannel(float64(sampleRate), reverbStereoSpread)
+	r.preDelay = NewDelayLine(int(maxPreDelaySecs*float64(sampleRate)) + 1)
+}
+
+func (r *Reverb) Output(secs float64) float64 {
+	left, right := r.OutputStereo(secs)
+	return (left + right) / 2
+}
+
+func (r *Reverb) OutputStereo(secs float64) (left, right float64) {
+	if r.inputSignal == nil {
+		return 0, 0
+	}
+	l, rt := OutputStereo(r.inputSignal, secs)
+	if !r.IsActive() {
+		return l, rt
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.next(l, rt, r.Params)
+}
+
+func (r *Reverb) Process(ctx *ProcessContext, out []float64) {
+	r.outL = growBuffer(r.outL, len(out))
+	r.outR = growBuffer(r.outR, len(out))
+	r.ProcessStereo(ctx, r.outL, r.outR)
+	midBuffer(out, r.outL, r.outR)
+}
+
+func (r *Reverb) ProcessStereo(ctx *ProcessContext, left, right []float64) {
+	if r.inputSignal == nil {
+		zeroBuffer(left)
+		zeroBuffer(right)
+		return
+	}
+	ProcessStereoBlock(ctx, r.inputSignal, left, right)
+	if !r.IsActive() {
+		return
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.setSampleRate(ctx.SampleRate)
+	params := r.Params
+	for i := range left {
+		left[i], right[i] = r.next(left[i], right[i], params)
+	}
+}
+
+// next computes the next stereo sample; mx must be locked
+func (r *Reverb) next(l, rt float64, params ReverbParams) (float64, float64) {
+	x := (l + rt) / 2 * reverbInputGain
+	preDelay := math.Round(params.PreDelay / 1000 * float64(r.sampleRate))
+	delayed := r.preDelay.Tap(int(preDelay))
+	r.preDelay.Write(x)
+	if preDelay >= 1 {
+		x = delayed
+	}
+
+	feedback := clamp01(params.RoomSize)*reverbRoomScale + reverbRoomOffset
+	damping := clamp01(params.Damping) * reverbDampScale
+	wetL := r.left.next(x, feedback, damping)
+	wetR := r.right.next(x, feedback, damping)
+
+	// width crossfades from mono (0) to the full stereo image (1)
+	width := clamp01(params.Width)
+	wet1 := reverbWetGain * (width/2 + 0.5)
+	wet2 := reverbWetGain * (1 - width) / 2
+	mix := clamp01(params.Mix)
+	return (1-mix)*l + mix*(wet1*wetL+wet2*wetR),
+		(1-mix)*rt + mix*(wet1*wetR+wet2*wetL)
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(v, 1))
 }
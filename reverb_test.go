@@ -0,0 +1,89 @@
+package wavx
+
+import (
+	"math"
+	"testing"
+)
+
+func reverbImpulseResponse(params ReverbParams, sampleRate int, n int) (left, right []float64) {
+	r := NewReverb(float64(sampleRate))
+	r.ChangeParameters(params)
+	r.ConnectInput(ReverbInputSignal, impulse{})
+	left = make([]float64, n)
+	right = make([]float64, n)
+	r.ProcessStereo(&ProcessContext{SampleRate: sampleRate}, left, right)
+	return left, right
+}
+
+func TestReverbTail(t *testing.T) {
+	const sampleRate = 44100
+	params := ReverbParams{RoomSize: 0.5, Damping: 0.5, Width: 1, Mix: 1}
+	left, right := reverbImpulseResponse(params, sampleRate, 2*sampleRate)
+	early := rms(left[sampleRate/10 : sampleRate/5])
+	late := rms(left[sampleRate : sampleRate+sampleRate/10])
+	if early == 0 || late >= early {
+		t.Errorf("want a decaying tail, have rms %g early and %g late", early, late)
+	}
+	for i, v := range left {
+		if math.IsNaN(v) || math.Abs(v) > 1 {
+			t.Fatalf("sample %d: invalid value %f", i, v)
+		}
+	}
+	var diff float64
+	for i := range left {
+		diff += math.Abs(left[i] - right[i])
+	}
+	if diff == 0 {
+		t.Errorf("want different channels at full width")
+	}
+
+	// a larger room rings longer
+	params.RoomSize = 1
+	largeL, _ := reverbImpulseResponse(params, sampleRate, 2*sampleRate)
+	if have := rms(largeL[sampleRate : sampleRate+sampleRate/10]); have <= late {
+		t.Errorf("want a longer tail in a larger room, have rms %g, small room %g", have, late)
+	}
+
+	// more damping attenuates the tail
+	params.RoomSize = 0.5
+	params.Damping = 1
+	dampedL, _ := reverbImpulseResponse(params, sampleRate, 2*sampleRate)
+	if have := rms(dampedL[sampleRate : sampleRate+sampleRate/10]); have >= late {
+		t.Errorf("want a weaker tail with more damping, have rms %g, less damping %g", have, late)
+	}
+}
+
+func TestReverbParams(t *testing.T) {
+	const sampleRate = 44100
+	// pre-delay: the wet signal starts after 50 ms
+	left, _ := reverbImpulseResponse(ReverbParams{RoomSize: 0.5, Width: 1, PreDelay: 50, Mix: 1}, sampleRate, sampleRate/5)
+	preDelay := sampleRate * 50 / 1000
+	for i := 0; i < preDelay; i++ {
+		if left[i] != 0 {
+			t.Fatalf("pre-delay: want silence at sample %d, have %f", i, left[i])
+		}
+	}
+	if rms(left[preDelay:]) == 0 {
+		t.Errorf("pre-delay: want signal after %d samples", preDelay)
+	}
+
+	// width 0 is mono
+	left, right := reverbImpulseResponse(ReverbParams{RoomSize: 0.5, Width: 0, Mix: 1}, sampleRate, sampleRate/5)
+	for i := range left {
+		if math.Abs(left[i]-right[i]) > 1e-12 {
+			t.Fatalf("width 0: want equal channels at sample %d, have %f/%f", i, left[i], right[i])
+		}
+	}
+
+	// mix 0 is dry
+	left, _ = reverbImpulseResponse(ReverbParams{RoomSize: 0.5, Width: 1, Mix: 0}, sampleRate, sampleRate/5)
+	if left[0] != 1 || rms(left[1:]) != 0 {
+		t.Errorf("mix 0: want the dry impulse only")
+	}
+
+	r := NewReverb(sampleRate)
+	r.Execute(Command{"roomsize": "0.8", "mix": "+0.1", "predelay": "20"})
+	if have := r.Parameters(); have.RoomSize != 0.8 || have.Mix != 0.6 || have.PreDelay != 20 {
+		t.Errorf("execute: have %+v", have)
+	}
+}
@@ -0,0 +1,242 @@
+package wavx
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RenderFunc fills buf with interleaved frames
+type RenderFunc func(buf []float64)
+
+// AudioSink consumes the samples of a Synthesizer. Open passes the function which renders the next frames.
+type AudioSink interface {
+	Open(sampleRate int, channels int, render RenderFunc) error
+	Start() error
+	Stop() error
+	Close() error
+}
+
+const DefaultFramesPerBuffer = 512
+
+// pullSink drives the rendering for sinks which are not fed by an audio device callback.
+// Unless Realtime is set, rendering runs as fast as the sink accepts the samples.
+type pullSink struct {
+	Realtime        bool
+	FramesPerBuffer int
+	sampleRate      int
+	channels        int
+	render          RenderFunc
+	write           func(buf []float64) error
+	mx              sync.Mutex
+	stopC           chan struct{}
+	doneC           chan struct{}
+	err             error
+}
+
+func (s *pullSink) open(sampleRate int, channels int, render RenderFunc, write func(buf []float64) error) {
+	s.sampleRate = sampleRate
+	s.channels = channels
+	s.render = render
+	s.write = write
+	if s.FramesPerBuffer <= 0 {
+		s.FramesPerBuffer = DefaultFramesPerBuffer
+	}
+}
+
+func (s *pullSink) Start() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.render == nil {
+		return errors.Errorf("sink is not open")
+	}
+	if s.stopC != nil {
+		return errors.Errorf("sink is already started")
+	}
+	s.stopC = make(chan struct{})
+	s.doneC = make(chan struct{})
+	go s.run(s.stopC, s.doneC)
+	return nil
+}
+
+func (s *pullSink) Stop() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.stopC == nil {
+		return nil
+	}
+	close(s.stopC)
+	<-s.doneC
+	s.stopC = nil
+	s.doneC = nil
+	return s.err
+}
+
+func (s *pullSink) run(stopC <-chan struct{}, doneC chan<- struct{}) {
+	defer close(doneC)
+	buf := make([]float64, s.FramesPerBuffer*s.channels)
+	bufDur := time.Duration(float64(s.FramesPerBuffer) / float64(s.sampleRate) * float64(time.Second))
+	next := time.Now()
+	for {
+		select {
+		case <-stopC:
+			return
+		default:
+		}
+		s.render(buf)
+		err := s.write(buf)
+		if err != nil {
+			s.err = errors.Wrap(err, "write")
+			return
+		}
+		if s.Realtime {
+			next = next.Add(bufDur)
+			select {
+			case <-stopC:
+				return
+			case <-time.After(time.Until(next)):
+			}
+		}
+	}
+}
+
+// WriterSink writes raw interleaved samples (e.g. s16le or f32le) to a writer, e.g. to stdout for piping into other tools
+type WriterSink struct {
+	pullSink
+	w      io.Writer
+	format WavSampleFormat
+	buf    []byte
+}
+
+func NewWriterSink(w io.Writer, format WavSampleFormat) *WriterSink {
+	return &WriterSink{
+		w:      w,
+		format: format,
+	}
+}
+
+func (s *WriterSink) Open(sampleRate int, channels int, render RenderFunc) error {
+	switch s.format {
+	case WavFormatPCM16, WavFormatFloat32:
+	default:
+		return errors.Errorf("unsupported sample format %q", s.format)
+	}
+	s.open(sampleRate, channels, render, func(buf []float64) error {
+		s.buf = encodeSamples(s.buf, buf, s.format)
+		_, err := s.w.Write(s.buf)
+		return err
+	})
+	return nil
+}
+
+func (s *WriterSink) Close() error {
+	return s.Stop()
+}
+
+// WavFileSink records the samples to a WAV file
+type WavFileSink struct {
+	pullSink
+	path   string
+	format WavSampleFormat
+	file   *os.File
+	ww     *WavWriter
+}
+
+func NewWavFileSink(path string, format WavSampleFormat) *WavFileSink {
+	return &WavFileSink{
+		path:   path,
+		format: format,
+	}
+}
+
+func (s *WavFileSink) Open(sampleRate int, channels int, render RenderFunc) error {
+	f, err := os.Create(s.path)
+	if err != nil {
+		return errors.Wrapf(err, "create file %q", s.path)
+	}
+	ww, err := NewWavWriter(f, sampleRate, channels, s.format, 0)
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "new wav-writer")
+	}
+	s.file = f
+	s.ww = ww
+	s.open(sampleRate, channels, render, ww.Write)
+	return nil
+}
+
+func (s *WavFileSink) Close() error {
+	err := s.Stop()
+	if s.file == nil {
+		return err
+	}
+	if werr := s.ww.Close(); werr != nil && err == nil {
+		err = errors.Wrap(werr, "close wav-writer")
+	}
+	if ferr := s.file.Close(); ferr != nil && err == nil {
+		err = errors.Wrap(ferr, "close file")
+	}
+	s.file = nil
+	s.ww = nil
+	return err
+}
+
+// NullSink discards all samples. It is used to run a graph headless and to measure its performance.
+type NullSink struct {
+	pullSink
+	statsMx sync.RWMutex
+	frames  uint64
+	elapsed time.Duration
+}
+
+func NewNullSink() *NullSink {
+	return &NullSink{}
+}
+
+func (s *NullSink) Open(sampleRate int, channels int, render RenderFunc) error {
+	s.open(sampleRate, channels, func(buf []float64) {
+		t0 := time.Now()
+		render(buf)
+		d := time.Since(t0)
+
+		s.statsMx.Lock()
+		defer s.statsMx.Unlock()
+		s.frames += uint64(len(buf) / channels)
+		s.elapsed += d
+	}, func(buf []float64) error {
+		return nil
+	})
+	return nil
+}
+
+func (s *NullSink) Close() error {
+	return s.Stop()
+}
+
+// Frames returns the number of rendered frames
+func (s *NullSink) Frames() uint64 {
+	s.statsMx.RLock()
+	defer s.statsMx.RUnlock()
+	return s.frames
+}
+
+// RenderTime returns the time spent rendering
+func (s *NullSink) RenderTime() time.Duration {
+	s.statsMx.RLock()
+	defer s.statsMx.RUnlock()
+	return s.elapsed
+}
+
+// RealtimeFactor returns how much faster than realtime the graph is rendered
+func (s *NullSink) RealtimeFactor() float64 {
+	s.statsMx.RLock()
+	defer s.statsMx.RUnlock()
+	if s.elapsed == 0 {
+		return 0
+	}
+	audio := float64(s.frames) / float64(s.sampleRate)
+	return audio / s.elapsed.Seconds()
+}
@@ -0,0 +1,160 @@
+package wavx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stereoRamp outputs a ramp on the left and its negation on the right channel. reached is closed, once frames have been rendered.
+type stereoRamp struct {
+	frames  int
+	reached chan struct{}
+	once    sync.Once
+}
+
+func newStereoRamp(frames int) *stereoRamp {
+	return &stereoRamp{
+		frames:  frames,
+		reached: make(chan struct{}),
+	}
+}
+
+func (r *stereoRamp) Output(secs float64) float64 {
+	return 0
+}
+
+func (r *stereoRamp) OutputStereo(secs float64) (left, right float64) {
+	if int(math.Round(secs*SampelRate44100)) >= r.frames-1 {
+		r.once.Do(func() { close(r.reached) })
+	}
+	v := rampAt(secs)
+	return v, -v
+}
+
+// rampAt rises by 0.5 per second and wraps, so it stays within [-1, 1] however long a sink runs
+func rampAt(secs float64) float64 {
+	return math.Mod(secs, 1) / 2
+}
+
+func (r *stereoRamp) wait(t *testing.T) {
+	select {
+	case <-r.reached:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for %d frames", r.frames)
+	}
+}
+
+// limitWriter accepts max writes and fails afterwards
+type limitWriter struct {
+	bytes.Buffer
+	max    int
+	writes int
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.writes >= w.max {
+		return 0, io.ErrShortWrite
+	}
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestWriterSink(t *testing.T) {
+	const buffers = 3
+	w := &limitWriter{max: buffers}
+	src := newStereoRamp(buffers * DefaultFramesPerBuffer)
+	synth := NewSynthesizer(SampelRate44100, src, NewWriterSink(w, WavFormatFloat32))
+	if err := synth.Open(); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := synth.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	src.wait(t)
+	synth.Close()
+
+	// f32le, interleaved left and right
+	b := w.Bytes()
+	if len(b) != buffers*DefaultFramesPerBuffer*2*4 {
+		t.Fatalf("want %d bytes, have %d", buffers*DefaultFramesPerBuffer*2*4, len(b))
+	}
+	for i := 0; i < buffers*DefaultFramesPerBuffer; i++ {
+		left := float64(math.Float32frombits(binary.LittleEndian.Uint32(b[8*i:])))
+		right := float64(math.Float32frombits(binary.LittleEndian.Uint32(b[8*i+4:])))
+		want := rampAt(float64(i) / SampelRate44100)
+		if math.Abs(left-want) > 1e-6 || math.Abs(right+want) > 1e-6 {
+			t.Fatalf("frame %d: want (%f, %f), have (%f, %f)", i, want, -want, left, right)
+		}
+	}
+}
+
+func TestWavFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	src := newStereoRamp(2 * DefaultFramesPerBuffer)
+	synth := NewSynthesizer(SampelRate44100, src, NewWavFileSink(path, WavFormatFloat32))
+	if err := synth.Open(); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := synth.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	src.wait(t)
+	if err := synth.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open file: %v", err)
+	}
+	defer f.Close()
+	format, samples := readWavSamples(t, f)
+	if format.NumChannels != 2 || format.SampleRate != SampelRate44100 {
+		t.Fatalf("unexpected format %+v", format)
+	}
+	if len(samples) < 2*DefaultFramesPerBuffer || len(samples)%DefaultFramesPerBuffer != 0 {
+		t.Fatalf("want whole buffers of at least %d frames, have %d", 2*DefaultFramesPerBuffer, len(samples))
+	}
+	for i, s := range samples {
+		left := float64(s.Values[0]) / math.MaxInt32
+		right := float64(s.Values[1]) / math.MaxInt32
+		want := rampAt(float64(i) / SampelRate44100)
+		if math.Abs(left-want) > 1e-6 || math.Abs(right+want) > 1e-6 {
+			t.Fatalf("frame %d: want (%f, %f), have (%f, %f)", i, want, -want, left, right)
+		}
+	}
+}
+
+func TestNullSink(t *testing.T) {
+	sink := NewNullSink()
+	src := newStereoRamp(10 * DefaultFramesPerBuffer)
+	synth := NewSynthesizer(SampelRate44100, src, sink)
+	if err := synth.Open(); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := synth.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	// without Realtime the sink renders as fast as possible, i.e. much faster than 10 buffers of audio time
+	t0 := time.Now()
+	src.wait(t)
+	if d := time.Since(t0); d > time.Second {
+		t.Errorf("rendering 10 buffers took %s", d)
+	}
+	if err := synth.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if sink.Frames() < 10*DefaultFramesPerBuffer {
+		t.Errorf("want at least %d frames, have %d", 10*DefaultFramesPerBuffer, sink.Frames())
+	}
+	if sink.RealtimeFactor() <= 1 {
+		t.Errorf("want faster than realtime, have factor %f", sink.RealtimeFactor())
+	}
+}
@@ -0,0 +1,66 @@
+package wavx
+
+// StereoOutputter is implemented by components which produce a left and a right channel.
+// Their mono Output is the mid signal (left+right)/2.
+type StereoOutputter interface {
+	Outputter
+	OutputStereo(secs float64) (left, right float64)
+}
+
+// StereoBlockProcessor is the block based counterpart of StereoOutputter
+type StereoBlockProcessor interface {
+	ProcessStereo(ctx *ProcessContext, left, right []float64)
+}
+
+// OutputStereo returns both channels of op. Mono components are placed in the center.
+func OutputStereo(op Outputter, secs float64) (left, right float64) {
+	if so, ok := op.(StereoOutputter); ok {
+		return so.OutputStereo(secs)
+	}
+	v := op.Output(secs)
+	return v, v
+}
+
+// ProcessStereoBlock fills left and right with the next block of op. Mono components are placed in the center.
+func ProcessStereoBlock(ctx *ProcessContext, op Outputter, left, right []float64) {
+	switch op := op.(type) {
+	case StereoBlockProcessor:
+		op.ProcessStereo(ctx, left, right)
+	case StereoOutputter:
+		for i := range left {
+			left[i], right[i] = op.OutputStereo(ctx.Secs(i))
+		}
+	default:
+		ProcessBlock(ctx, op, left)
+		copy(right, left)
+	}
+}
+
+// stereoCarrier is implemented by stereo components, which only carry distinct channels, if their inputs do
+type stereoCarrier interface {
+	carriesStereo() bool
+}
+
+// carriesStereo reports whether op produces distinct channels, e.g. an Adder of mono signals doesn't
+func carriesStereo(op Outputter) bool {
+	if c, ok := op.(stereoCarrier); ok {
+		return c.carriesStereo()
+	}
+	return isStereo(op)
+}
+
+func isStereo(op Outputter) bool {
+	switch op.(type) {
+	case StereoBlockProcessor, StereoOutputter:
+		return true
+	default:
+		return false
+	}
+}
+
+// midBuffer writes the mid signal of left and right to out
+func midBuffer(out, left, right []float64) {
+	for i := range out {
+		out[i] = (left[i] + right[i]) / 2
+	}
+}
@@ -0,0 +1,49 @@
+package wavx
+
+import (
+	"math"
+	"testing"
+)
+
+type stereoTestComponent interface {
+	Outputter
+	ConnectInput(input string, op Outputter)
+}
+
+func TestStereoComponents(t *testing.T) {
+	tests := map[string]func() stereoTestComponent{
+		"amplituder": func() stereoTestComponent { return NewAmplituder(0.5) },
+		"distortion": func() stereoTestComponent { return NewDistortion(0.3) },
+		"filter":     func() stereoTestComponent { return NewFilter(FilterModeLowPass, 0.2, 0.6) },
+		"biquad":     func() stereoTestComponent { return NewBiquad(BiquadLowPass, 800, 2, 0) },
+		"ladder":     func() stereoTestComponent { return NewLadder(800, 0.5, 24) },
+		"svf":        func() stereoTestComponent { return NewSVF(SVFBandPass, 800, 0.5, 24) },
+		"eq": func() stereoTestComponent {
+			eq, _ := NewEQ(EQBand{Type: EQPeak, Freq: 1000, Gain: 6, Q: 1})
+			return eq
+		},
+	}
+	newSource := func() Outputter {
+		return NewStdOscillator(StdOscillatorSaw, 220, 1, 0)
+	}
+	for name, newComponent := range tests {
+		// a hard left signal is filtered on the left channel only
+		stereo := newComponent()
+		hardLeft := NewPan(-1, PanLawConstantPower)
+		hardLeft.ConnectInput(PanInputSignal, newSource())
+		stereo.ConnectInput("signal", hardLeft)
+		left := make([]float64, 512)
+		right := make([]float64, 512)
+		ProcessStereoBlock(&ProcessContext{SampleRate: SampelRate44100}, stereo, left, right)
+
+		mono := newComponent()
+		mono.ConnectInput("signal", newSource())
+		want := make([]float64, 512)
+		ProcessBlock(&ProcessContext{SampleRate: SampelRate44100}, mono, want)
+		for i := range want {
+			if math.Abs(left[i]-want[i]) > 1e-12 || right[i] != 0 {
+				t.Fatalf("%s, frame %d: want (%f, 0), have (%f, %f)", name, i, want[i], left[i], right[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package wavx
+
+import (
+	"math"
+	"sync"
+
+	"github.com/mazzegi/log"
+)
+
+type SVFMode string
+
+const (
+	SVFLowPass  SVFMode = "lowpass"
+	SVFHighPass SVFMode = "highpass"
+	SVFBandPass SVFMode = "bandpass"
+	SVFNotch    SVFMode = "notch"
+)
+
+var svfModes = []SVFMode{SVFLowPass, SVFHighPass, SVFBandPass, SVFNotch}
+
+const (
+	SVFInputSignal = "signal"
+	// SVFInputCutoffOctaveModulation is in octaves, so +1 doubles the cutoff
+	SVFInputCutoffOctaveModulation = "cutoff-octave-modulation"
+	// SVFInputCutoffModulation is the input name of Filter, which is accepted as an alias of SVFInputCutoffOctaveModulation
+	SVFInputCutoffModulation = FilterInputCutoffModulation
+	// SVFInputResonanceModulation is added to the resonance
+	SVFInputResonanceModulation = "resonance-modulation"
+)
+
+// SVFParams holds the svf params; Mode selects the main output, Cutoff is in Hz, Resonance in [0, 1]
+// self-oscillates at 1 and saturates from svfSaturationResonance on, Slope is 12 or 24 dB/octave
+type SVFParams struct {
+	Mode      SVFMode
+	Cutoff    float64
+	Resonance float64
+	Slope     int
+}
+
+const (
+	// svfSaturation is the level, around which the band state saturates
+	svfSaturation = 2.0
+	// svfSaturationResonance is the resonance, from which on the band state saturates to bound the self-oscillation.
+	// Below, the filter is linear.
+	svfSaturationResonance = 0.9
+)
+
+// svfStage is a trapezoidal (zero delay feedback) state variable filter, which stays stable under fast modulation
+type svfStage struct {
+	ic1eq, ic2eq float64
+}
+
+// next returns lowpass, highpass, bandpass and notch of v; g = tan(pi*cutoff/sampleRate), k = 1/Q
+func (s *svfStage) next(v, g, k float64, saturate bool) [4]float64 {
+	a1 := 1 / (1 + g*(g+k))
+	a2 := g * a1
+	a3 := g * a2
+	v3 := v - s.ic2eq
+	v1 := a1*s.ic1eq + a2*v3
+	v2 := s.ic2eq + a2*s.ic1eq + a3*v3
+	s.ic1eq = 2*v1 - s.ic1eq
+	if saturate {
+		s.ic1eq = svfSaturation * math.Tanh(s.ic1eq/svfSaturation)
+	}
+	s.ic2eq = 2*v2 - s.ic2eq
+	low, band := v2, v1
+	high := v - k*v1 - v2
+	return [4]float64{low, high, band, low + high}
+}
+
+// SVF is a state variable filter with simultaneous lowpass, highpass, bandpass and notch outputs.
+// The outputs are computed once per sample or block, so they may be consumed by different components.
+// Stereo signals are filtered per channel.
+type SVF struct {
+	mx                sync.RWMutex
+	Params            SVFParams
+	inputSignal       Outputter
+	inputCutoffMod    Outputter
+	inputResonanceMod Outputter
+	cutoffModBuf      []float64
+	resonanceModBuf   []float64
+	sampleRate        int
+	// stages holds per channel the first stage and the second stages of the four outputs for 24 dB
+	stages [2][5]svfStage
+	// cache holds the four outputs of the left channel followed by those of the right channel
+	cache *frameCache
+	Activator
+}
+
+func NewSVF(mode SVFMode, cutoff float64, resonance float64, slope int) *SVF {
+	return &SVF{
+		Params: SVFParams{
+			Mode:      mode,
+			Cutoff:    cutoff,
+			Resonance: resonance,
+			Slope:     slope,
+		},
+		sampleRate: SampelRate44100,
+		cache:      newFrameCache(2 * len(svfModes)),
+	}
+}
+
+func (f *SVF) Inputs() []string {
+	return []string{
+		SVFInputSignal,
+		SVFInputCutoffOctaveModulation,
+		SVFInputCutoffModulation,
+		SVFInputResonanceModulation,
+	}
+}
+
+func (f *SVF) ConnectInput(input string, op Outputter) {
+	switch input {
+	case SVFInputSignal:
+		f.inputSignal = op
+	case SVFInputCutoffOctaveModulation, SVFInputCutoffModulation:
+		f.inputCutoffMod = op
+	case SVFInputResonanceModulation:
+		f.inputResonanceMod = op
+	default:
+		log.Warnf("no such input %q", input)
+	}
+}
+
+func (f *SVF) Outputs() []string {
+	var outputs []string
+	for _, m := range svfModes {
+		outputs = append(outputs, string(m))
+	}
+	return outputs
+}
+
+func (f *SVF) OutputOf(name string) (Outputter, bool) {
+	for i, m := range svfModes {
+		if string(m) == name {
+			return &svfOutput{svf: f, idx: i}, true
+		}
+	}
+	return nil, false
+}
+
+func (f *SVF) Execute(cmd Command) {
+	params := f.Parameters()
+	err := ApplyCommand(cmd, &params)
+	if err != nil {
+		log.Warnf("apply-command: %v", err)
+		return
+	}
+	f.ChangeParameters(params)
+}
+
+func (f *SVF) Parameters() SVFParams {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	return f.Params
+}
+
+func (f *SVF) ChangeParameters(params SVFParams) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.Params = params
+}
+
+func (f *SVF) SetSampleRate(sampleRate int) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.sampleRate = sampleRate
+}
+
+func (f *SVF) modeIndex() int {
+	for i, m := range svfModes {
+		if m == f.Parameters().Mode {
+			return i
+		}
+	}
+	return 0
+}
+
+func (f *SVF) carriesStereo() bool {
+	return f.inputSignal != nil && carriesStereo(f.inputSignal)
+}
+
+func (f *SVF) Output(secs float64) float64 {
+	return f.outputOf(f.modeIndex(), secs)
+}
+
+func (f *SVF) OutputStereo(secs float64) (left, right float64) {
+	return f.outputStereoOf(f.modeIndex(), secs)
+}
+
+func (f *SVF) Process(ctx *ProcessContext, out []float64) {
+	f.processOf(f.modeIndex(), ctx, out)
+}
+
+func (f *SVF) ProcessStereo(ctx *ProcessContext, left, right []float64) {
+	f.processStereoOf(f.modeIndex(), ctx, left, right)
+}
+
+// outputOf returns the mid signal of output idx at secs
+func (f *SVF) outputOf(idx int, secs float64) float64 {
+	l, r := f.outputStereoOf(idx, secs)
+	return (l + r) / 2
+}
+
+// outputStereoOf returns both channels of output idx at secs
+func (f *SVF) outputStereoOf(idx int, secs float64) (left, right float64) {
+	vals := f.cache.sample(f, secs)
+	return vals[idx], vals[len(svfModes)+idx]
+}
+
+// processOf fills out with the mid signal of output idx of the block at ctx
+func (f *SVF) processOf(idx int, ctx *ProcessContext, out []float64) {
+	blocks := f.cache.fill(f, ctx, len(out))
+	midBuffer(out, blocks[idx], blocks[len(svfModes)+idx])
+}
+
+// processStereoOf fills left and right with output idx of the block at ctx
+func (f *SVF) processStereoOf(idx int, ctx *ProcessContext, left, right []float64) {
+	blocks := f.cache.fill(f, ctx, len(left))
+	copy(left, blocks[idx])
+	copy(right, blocks[len(svfModes)+idx])
+}
+
+func (f *SVF) nextSample(secs float64, vals []float64) {
+	n := len(svfModes)
+	stereo := f.carriesStereo()
+	var l, r, cutoffMod, resonanceMod float64
+	if stereo {
+		l, r = OutputStereo(f.inputSignal, secs)
+	} else if f.inputSignal != nil {
+		l = f.inputSignal.Output(secs)
+	}
+	if f.inputCutoffMod != nil {
+		cutoffMod = f.inputCutoffMod.Output(secs)
+	}
+	if f.inputResonanceMod != nil {
+		resonanceMod = f.inputResonanceMod.Output(secs)
+	}
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	outs := f.next(&f.stages[0], l, f.Params, cutoffMod, resonanceMod, f.sampleRate)
+	copy(vals[:n], outs[:])
+	if stereo {
+		outs = f.next(&f.stages[1], r, f.Params, cutoffMod, resonanceMod, f.sampleRate)
+	}
+	copy(vals[n:], outs[:])
+}
+
+func (f *SVF) nextBlock(ctx *ProcessContext, blocks [][]float64) {
+	n := len(blocks[0])
+	left, right := blocks[:len(svfModes)], blocks[len(svfModes):]
+	stereo := f.carriesStereo()
+	switch {
+	case stereo:
+		ProcessStereoBlock(ctx, f.inputSignal, left[0], right[0])
+	case f.inputSignal != nil:
+		ProcessBlock(ctx, f.inputSignal, left[0])
+	default:
+		zeroBuffer(left[0])
+	}
+	var cutoffMod, resonanceMod []float64
+	if f.inputCutoffMod != nil {
+		f.cutoffModBuf = growBuffer(f.cutoffModBuf, n)
+		cutoffMod = f.cutoffModBuf
+		ProcessBlock(ctx, f.inputCutoffMod, cutoffMod)
+	}
+	if f.inputResonanceMod != nil {
+		f.resonanceModBuf = growBuffer(f.resonanceModBuf, n)
+		resonanceMod = f.resonanceModBuf
+		ProcessBlock(ctx, f.inputResonanceMod, resonanceMod)
+	}
+
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.sampleRate = ctx.SampleRate
+	for i := 0; i < n; i++ {
+		var cm, rm float64
+		if cutoffMod != nil {
+			cm = cutoffMod[i]
+		}
+		if resonanceMod != nil {
+			rm = resonanceMod[i]
+		}
+		outs := f.next(&f.stages[0], left[0][i], f.Params, cm, rm, ctx.SampleRate)
+		for j := range left {
+			left[j][i] = outs[j]
+		}
+		if !stereo {
+			continue
+		}
+		outs = f.next(&f.stages[1], right[0][i], f.Params, cm, rm, ctx.SampleRate)
+		for j := range right {
+			right[j][i] = outs[j]
+		}
+	}
+	if !stereo {
+		for j := range right {
+			copy(right[j], left[j])
+		}
+	}
+}
+
+// next filters the next sample through the stages s; an inactive filter passes v to all outputs; mx must be locked
+func (f *SVF) next(s *[5]svfStage, v float64, params SVFParams, cutoffMod, resonanceMod float64, sampleRate int) [4]float64 {
+	if !f.IsActive() {
+		return [4]float64{v, v, v, v}
+	}
+	cutoff := params.Cutoff * math.Pow(2, cutoffMod)
+	cutoff = math.Max(minBiquadCutoff, math.Min(cutoff, 0.49*float64(sampleRate)))
+	g := math.Tan(math.Pi * cutoff / float64(sampleRate))
+	res := math.Max(0, math.Min(params.Resonance+resonanceMod, 1))
+	// a slightly negative damping lets the filter self-oscillate at full resonance
+	k := 2 - 2.05*res
+	saturate := res >= svfSaturationResonance
+
+	outs := s[0].next(v, g, k, saturate)
+	if params.Slope != 24 {
+		return outs
+	}
+	// each output passes a second stage of its own type
+	for i := range outs {
+		outs[i] = s[i+1].next(outs[i], g, k, saturate)[i]
+	}
+	return outs
+}
+
+// svfOutput is a single output of a SVF
+type svfOutput struct {
+	svf *SVF
+	idx int
+}
+
+func (o *svfOutput) Output(secs float64) float64 {
+	return o.svf.outputOf(o.idx, secs)
+}
+
+func (o *svfOutput) OutputStereo(secs float64) (left, right float64) {
+	return o.svf.outputStereoOf(o.idx, secs)
+}
+
+func (o *svfOutput) Process(ctx *ProcessContext, out []float64) {
+	o.svf.processOf(o.idx, ctx, out)
+}
+
+func (o *svfOutput) ProcessStereo(ctx *ProcessContext, left, right []float64) {
+	o.svf.processStereoOf(o.idx, ctx, left, right)
+}
+
+func (o *svfOutput) carriesStereo() bool {
+	return o.svf.carriesStereo()
+}
@@ -1,8 +1,6 @@
 package wavx
 
 import (
-	"github.com/gordonklaus/portaudio"
-	"github.com/mazzegi/log"
 	"github.com/pkg/errors"
 )
 
@@ -22,76 +20,102 @@ type InputOutputter interface {
 const SampelRate44100 = 44100
 
 type Synthesizer struct {
-	stream     *portaudio.Stream
+	sink       AudioSink
 	steps      uint64
 	sampleRate int
+	channels   int
 	outputter  Outputter
+	ctx        ProcessContext
+	bufL, bufR []float64
 }
 
-func NewSynthesizer(sampleRate int, outputter Outputter) *Synthesizer {
+// NewSynthesizer creates a stereo synthesizer. Mono outputters are placed in the center.
+func NewSynthesizer(sampleRate int, outputter Outputter, sink AudioSink) *Synthesizer {
 	s := &Synthesizer{
 		sampleRate: sampleRate,
+		channels:   2,
 		outputter:  outputter,
+		sink:       sink,
 	}
 
 	return s
 }
 
-func (s *Synthesizer) Open() error {
-	err := portaudio.Initialize()
-	if err != nil {
-		return errors.Wrap(err, "portaudio: initialize")
+// SetChannels sets the number of output channels (1 or 2). It has to be called before Open.
+func (s *Synthesizer) SetChannels(n int) error {
+	if n != 1 && n != 2 {
+		return errors.Errorf("unsupported number of channels %d", n)
 	}
+	s.channels = n
+	return nil
+}
+
+func (s *Synthesizer) Channels() int {
+	return s.channels
+}
 
-	s.stream, err = portaudio.OpenDefaultStream(0, 1, float64(s.sampleRate), 0, func(out [][]float32) {
-		for i := range out[0] {
-			out[0][i] = s.Next()
-		}
-	})
+func (s *Synthesizer) Open() error {
+	if s.sink == nil {
+		return errors.Errorf("no sink")
+	}
+	err := s.sink.Open(s.sampleRate, s.channels, s.Render)
 	if err != nil {
-		s.Close()
-		return errors.Wrap(err, "portaudio: open-default-stream")
+		return errors.Wrap(err, "open sink")
 	}
 	return nil
 }
 
 func (s *Synthesizer) Close() error {
-	err := s.Stop()
-	if err != nil {
-		log.Errorf("portaudio: stop-stream: %v", err)
-	}
-	if s.stream != nil {
-		err := s.stream.Close()
-		if err != nil {
-			log.Errorf("portaudio: close-stream: %v", err)
-		}
-		s.stream = nil
-	}
-
-	err = portaudio.Terminate()
-	if err != nil {
-		return errors.Wrap(err, "portaudio: terminate")
+	if s.sink == nil {
+		return errors.Errorf("no sink")
 	}
-	return nil
+	return s.sink.Close()
 }
 
 func (s *Synthesizer) Start() error {
-	if s.stream == nil {
-		return errors.Errorf("stream is not open")
+	if s.sink == nil {
+		return errors.Errorf("no sink")
 	}
-	return s.stream.Start()
+	return s.sink.Start()
 }
 
 func (s *Synthesizer) Stop() error {
-	if s.stream == nil {
-		return errors.Errorf("stream is not open")
+	if s.sink == nil {
+		return errors.Errorf("no sink")
 	}
-	return s.stream.Stop()
+	return s.sink.Stop()
+}
+
+// Render fills buf with the next block of interleaved frames
+func (s *Synthesizer) Render(buf []float64) {
+	s.ctx = ProcessContext{
+		SampleRate: s.sampleRate,
+		Frame:      s.steps,
+	}
+	if s.channels == 1 {
+		ProcessBlock(&s.ctx, s.outputter, buf)
+		s.steps += uint64(len(buf))
+		return
+	}
+
+	n := len(buf) / 2
+	s.bufL = growBuffer(s.bufL, n)
+	s.bufR = growBuffer(s.bufR, n)
+	ProcessStereoBlock(&s.ctx, s.outputter, s.bufL, s.bufR)
+	for i := 0; i < n; i++ {
+		buf[2*i] = s.bufL[i]
+		buf[2*i+1] = s.bufR[i]
+	}
+	s.steps += uint64(n)
 }
 
 func (s *Synthesizer) Next() float32 {
+	return float32(s.next())
+}
+
+func (s *Synthesizer) next() float64 {
 	secs := float64(s.steps) / float64(s.sampleRate)
 	v := s.outputter.Output(secs)
 	s.steps++
-	return float32(v)
+	return v
 }
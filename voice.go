@@ -0,0 +1,26 @@
+package wavx
+
+// Voice is a single voice of a polyphonic component. NoteOn and NoteOff take effect with the next sample,
+// so they may be called between two blocks.
+type Voice interface {
+	Outputter
+	NoteOn(freq float64)
+	NoteOff()
+}
+
+// VoiceTemplate creates the voices of a polyphonic component; each voice has its own state
+type VoiceTemplate interface {
+	NewVoice() (Voice, error)
+}
+
+// PhaseSetter is implemented by voices and oscillators, whose phase (in cycles) may be set,
+// e.g. to start the unison voices of a pool with random phases
+type PhaseSetter interface {
+	SetPhase(phase float64)
+}
+
+// Gater is implemented by components with envelopes, which follow the note of a voice
+type Gater interface {
+	GateOn()
+	GateOff()
+}
@@ -16,22 +16,35 @@ type WavOutputter struct {
 }
 
 func NewWavOutputter(filePath string) (*WavOutputter, error) {
+	format, samples, max, err := readWavFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	o := &WavOutputter{
+		format:  format,
+		samples: samples,
+		scale:   1.0 / float64(max),
+	}
+	log.Infof("format: channels=%d, sample-rate=%d, bits-per-sample=%d, max=%d", format.NumChannels, format.SampleRate, format.BitsPerSample, max)
+
+	return o, nil
+}
+
+// readWavFile reads all samples of a wav file and returns them with the maximum absolute sample value
+func readWavFile(filePath string) (*wav.WavFormat, []wav.Sample, int, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
-		return nil, errors.Wrapf(err, "open file %q", filePath)
+		return nil, nil, 0, errors.Wrapf(err, "open file %q", filePath)
 	}
 	defer f.Close()
 
 	wr := wav.NewReader(f)
 	format, err := wr.Format()
 	if err != nil {
-		return nil, errors.Wrap(err, "read format")
-	}
-
-	o := &WavOutputter{
-		format: format,
+		return nil, nil, 0, errors.Wrap(err, "read format")
 	}
 
+	var samples []wav.Sample
 	var max int
 	err = func() error {
 		for {
@@ -49,17 +62,16 @@ func NewWavOutputter(filePath string) (*WavOutputter, error) {
 					max = m
 				}
 			}
-			o.samples = append(o.samples, smpls...)
+			samples = append(samples, smpls...)
 		}
 	}()
 	if err != nil {
-		return nil, err
+		return nil, nil, 0, err
 	}
-
-	o.scale = 1.0 / float64(max)
-	log.Infof("format: channels=%d, sample-rate=%d, bits-per-sample=%d, max=%d", format.NumChannels, format.SampleRate, format.BitsPerSample, max)
-
-	return o, nil
+	if len(samples) == 0 || max == 0 {
+		return nil, nil, 0, errors.Errorf("file %q contains no signal", filePath)
+	}
+	return format, samples, max, nil
 }
 
 //sample-rate = 44100
@@ -68,5 +80,20 @@ func (o *WavOutputter) Output(secs float64) float64 {
 	sampleIdx = sampleIdx % len(o.samples)
 
 	sample := o.samples[sampleIdx]
-	return float64(sample.Values[0]) * o.scale
+	if o.format.NumChannels < 2 {
+		return float64(sample.Values[0]) * o.scale
+	}
+	return float64(sample.Values[0]+sample.Values[1]) * o.scale / 2
+}
+
+func (o *WavOutputter) OutputStereo(secs float64) (left, right float64) {
+	sampleIdx := RoundInt(secs * float64(o.format.SampleRate))
+	sampleIdx = sampleIdx % len(o.samples)
+
+	sample := o.samples[sampleIdx]
+	if o.format.NumChannels < 2 {
+		v := float64(sample.Values[0]) * o.scale
+		return v, v
+	}
+	return float64(sample.Values[0]) * o.scale, float64(sample.Values[1]) * o.scale
 }
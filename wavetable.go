@@ -0,0 +1,210 @@
+package wavx
+
+import (
+	"math"
+	"sync"
+
+	"github.com/mazzegi/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// WavetableInputFreqMod expects a frequency deviation in Hz
+	WavetableInputFreqMod = "frequency-modulation"
+	// WavetableInputPositionMod is added to the position
+	WavetableInputPositionMod = "position-modulation"
+)
+
+// WavetableParams holds the wavetable params; Position in [0, 1] morphs from the first to the last frame
+type WavetableParams struct {
+	Freq     float64
+	Ampl     float64
+	Position float64
+}
+
+// WavetableOscillator plays a table of single-cycle frames. It interpolates within a frame and between adjacent frames.
+type WavetableOscillator struct {
+	mx               sync.RWMutex
+	Params           WavetableParams
+	frames           [][]float64
+	FreqModInput     Outputter
+	PositionModInput Outputter
+	clock            sampleClock
+	phase            float64
+	freqModBuf       []float64
+	positionModBuf   []float64
+	Activator
+}
+
+// NewWavetableOscillator loads the frames from a wav file. Each frame consists of frameSize samples;
+// if frameSize is 0, the whole file is a single cycle. Multi-channel files are mixed down to mono.
+func NewWavetableOscillator(filePath string, frameSize int, freq float64, ampl float64) (*WavetableOscillator, error) {
+	format, samples, max, err := readWavFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	mono := make([]float64, len(samples))
+	for i, s := range samples {
+		if format.NumChannels < 2 {
+			mono[i] = float64(s.Values[0]) / float64(max)
+		} else {
+			mono[i] = float64(s.Values[0]+s.Values[1]) / float64(2*max)
+		}
+	}
+	if frameSize <= 0 {
+		frameSize = len(mono)
+	}
+	if frameSize < 2 {
+		return nil, errors.Errorf("frame size %d is too small", frameSize)
+	}
+	var frames [][]float64
+	for i := 0; i+frameSize <= len(mono); i += frameSize {
+		frames = append(frames, mono[i:i+frameSize])
+	}
+	if len(frames) == 0 {
+		return nil, errors.Errorf("file %q contains less than one frame of %d samples", filePath, frameSize)
+	}
+	log.Infof("wavetable: loaded %d frames of %d samples from %q", len(frames), frameSize, filePath)
+
+	return NewWavetableOscillatorFromFrames(frames, freq, ampl)
+}
+
+// NewWavetableOscillatorFromFrames creates a wavetable oscillator from frames of equal size
+func NewWavetableOscillatorFromFrames(frames [][]float64, freq float64, ampl float64) (*WavetableOscillator, error) {
+	if len(frames) == 0 {
+		return nil, errors.Errorf("no frames")
+	}
+	for i, f := range frames {
+		if len(f) != len(frames[0]) || len(f) < 2 {
+			return nil, errors.Errorf("frame %d has invalid size %d", i, len(f))
+		}
+	}
+	return &WavetableOscillator{
+		Params: WavetableParams{
+			Freq: freq,
+			Ampl: ampl,
+		},
+		frames: frames,
+	}, nil
+}
+
+func (o *WavetableOscillator) Inputs() []string {
+	return []string{
+		WavetableInputFreqMod,
+		WavetableInputPositionMod,
+	}
+}
+
+func (o *WavetableOscillator) ConnectInput(input string, op Outputter) {
+	switch input {
+	case WavetableInputFreqMod:
+		o.FreqModInput = op
+	case WavetableInputPositionMod:
+		o.PositionModInput = op
+	default:
+		log.Warnf("no such input %q", input)
+	}
+}
+
+func (o *WavetableOscillator) Execute(cmd Command) {
+	params := o.Parameters()
+	err := ApplyCommand(cmd, &params)
+	if err != nil {
+		log.Warnf("apply-command: %v", err)
+		return
+	}
+	o.ChangeParameters(params)
+}
+
+func (o *WavetableOscillator) Parameters() WavetableParams {
+	o.mx.RLock()
+	defer o.mx.RUnlock()
+	return o.Params
+}
+
+func (o *WavetableOscillator) ChangeParameters(params WavetableParams) {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+	o.Params = params
+}
+
+// Frames returns the number of frames in the table
+func (o *WavetableOscillator) Frames() int {
+	return len(o.frames)
+}
+
+func (o *WavetableOscillator) Output(secs float64) float64 {
+	if !o.IsActive() {
+		return 0
+	}
+	var freqMod, posMod float64
+	if o.FreqModInput != nil {
+		freqMod = o.FreqModInput.Output(secs)
+	}
+	if o.PositionModInput != nil {
+		posMod = o.PositionModInput.Output(secs)
+	}
+	return o.next(o.clock.elapsed(secs), o.Parameters(), freqMod, posMod)
+}
+
+func (o *WavetableOscillator) Process(ctx *ProcessContext, out []float64) {
+	if !o.IsActive() {
+		zeroBuffer(out)
+		return
+	}
+	var freqMod, posMod []float64
+	if o.FreqModInput != nil {
+		o.freqModBuf = growBuffer(o.freqModBuf, len(out))
+		freqMod = o.freqModBuf
+		ProcessBlock(ctx, o.FreqModInput, freqMod)
+	}
+	if o.PositionModInput != nil {
+		o.positionModBuf = growBuffer(o.positionModBuf, len(out))
+		posMod = o.positionModBuf
+		ProcessBlock(ctx, o.PositionModInput, posMod)
+	}
+	params := o.Parameters()
+	for i := range out {
+		var fm, pm float64
+		if freqMod != nil {
+			fm = freqMod[i]
+		}
+		if posMod != nil {
+			pm = posMod[i]
+		}
+		out[i] = o.next(o.clock.elapsed(ctx.Secs(i)), params, fm, pm)
+	}
+}
+
+func (o *WavetableOscillator) next(dt float64, params WavetableParams, freqMod, posMod float64) float64 {
+	o.phase = fract(o.phase + (params.Freq+freqMod)*dt)
+
+	pos := params.Position + posMod
+	if pos < 0 {
+		pos = 0
+	} else if pos > 1 {
+		pos = 1
+	}
+	fpos := pos * float64(len(o.frames)-1)
+	idx := int(fpos)
+	if idx >= len(o.frames)-1 {
+		return params.Ampl * o.frameValue(o.frames[len(o.frames)-1])
+	}
+	frac := fpos - float64(idx)
+	v0 := o.frameValue(o.frames[idx])
+	if frac == 0 {
+		return params.Ampl * v0
+	}
+	v1 := o.frameValue(o.frames[idx+1])
+	return params.Ampl * (v0 + frac*(v1-v0))
+}
+
+// frameValue interpolates the frame at the current phase
+func (o *WavetableOscillator) frameValue(frame []float64) float64 {
+	x := o.phase * float64(len(frame))
+	i := int(math.Floor(x))
+	frac := x - float64(i)
+	i %= len(frame)
+	j := (i + 1) % len(frame)
+	return frame[i] + frac*(frame[j]-frame[i])
+}
@@ -0,0 +1,60 @@
+package wavx
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWavetableOscillatorMorph(t *testing.T) {
+	const frameSize = 64
+	// two frames: a sine and an inverted sine
+	var samples []float64
+	for f := 0; f < 2; f++ {
+		for i := 0; i < frameSize; i++ {
+			v := math.Sin(2 * math.Pi * float64(i) / frameSize)
+			if f == 1 {
+				v = -v
+			}
+			samples = append(samples, v)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "table.wav")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	ww, _ := NewWavWriter(file, SampelRate44100, 1, WavFormatFloat32, len(samples))
+	ww.Write(samples)
+	ww.Close()
+	file.Close()
+
+	// one cycle per frame size samples
+	freq := float64(SampelRate44100) / frameSize
+	osc, err := NewWavetableOscillator(path, frameSize, freq, 1)
+	if err != nil {
+		t.Fatalf("new wavetable: %v", err)
+	}
+	if osc.Frames() != 2 {
+		t.Fatalf("want 2 frames, have %d", osc.Frames())
+	}
+
+	ctx := &ProcessContext{SampleRate: SampelRate44100}
+	buf := make([]float64, frameSize)
+	osc.Process(ctx, buf)
+	for i, v := range buf {
+		if math.Abs(v-samples[i]) > 1e-6 {
+			t.Fatalf("position 0, sample %d: want %f, have %f", i, samples[i], v)
+		}
+	}
+
+	osc.Execute(Command{"position": "0.5"})
+	ctx.Frame += frameSize
+	osc.Process(ctx, buf)
+	for i, v := range buf {
+		if math.Abs(v) > 1e-6 {
+			t.Fatalf("position 0.5, sample %d: want 0, have %f", i, v)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package wavl
 
 import (
 	"context"
+	"math"
 	"time"
 
 	"github.com/mazzegi/log"
@@ -38,6 +39,51 @@ func (l *Looper) Run(ctx context.Context, prj *Project) {
 	}
 }
 
+// RunSamples processes the events in sample time instead of wall-clock time.
+// Sleeps are converted to a number of frames which are passed to render, until numFrames frames have been rendered.
+func (l *Looper) RunSamples(prj *Project, sampleRate int, numFrames int, render func(n int) error) error {
+	var elapsed time.Duration
+	var frames int
+	renderUntil := func(target int) error {
+		if target > numFrames {
+			target = numFrames
+		}
+		if target <= frames {
+			return nil
+		}
+		err := render(target - frames)
+		if err != nil {
+			return err
+		}
+		frames = target
+		return nil
+	}
+
+	for frames < numFrames {
+		cycleStart := frames
+		for _, e := range l.events {
+			if frames >= numFrames {
+				return nil
+			}
+			switch e := e.(type) {
+			case SleepEvent:
+				elapsed += e.Duration
+				err := renderUntil(int(math.Round(elapsed.Seconds() * float64(sampleRate))))
+				if err != nil {
+					return err
+				}
+			case ProjectEvent:
+				e.projFunc(prj)
+			}
+		}
+		if frames == cycleStart {
+			// no time passes within the event list, so there is nothing left to schedule
+			return renderUntil(numFrames)
+		}
+	}
+	return nil
+}
+
 func (l *Looper) handle(ctx context.Context, prj *Project, e Event) {
 	switch e := e.(type) {
 	case SleepEvent:
@@ -3,6 +3,7 @@ package wavl
 import (
 	"bufio"
 	"io"
+	"math"
 	"os"
 	"strings"
 	"time"
@@ -36,6 +37,10 @@ func ParseFile(fileName string) (*Project, error) {
 
 type parser struct {
 	commands []string
+	// rawItems are the items of the current command before lower casing, e.g. for file paths
+	rawItems []string
+	// inVoice restricts the commands to the ones of a voice block
+	inVoice bool
 }
 
 func newParser(commands []string) *parser {
@@ -48,33 +53,93 @@ type projectFunc func(p *Project) error
 
 func (p *parser) parse() (*Project, error) {
 	prj := NewProject()
-	for _, cmd := range p.commands {
+	err := p.parseInto(prj)
+	if err != nil {
+		return nil, err
+	}
+	return prj, nil
+}
+
+/*
+voice lead
+add osc osc1 blsaw 110 0.5 0
+add fm fm1 220 1 2
+set fm1 op2.ratio:2 op2.level:0.5
+keytrack osc1
+keytrack fm1 freq 2
+add mixer mix
+connect osc1 mix
+connect fm1 mix
+output mix
+end
+*/
+
+func (p *parser) parseInto(prj *Project) error {
+	for i := 0; i < len(p.commands); i++ {
+		cmd := p.commands[i]
+		if isBlockStart(cmd, "voice") {
+			if p.inVoice {
+				return errors.Errorf("nested voice block %q", cmd)
+			}
+			end := i + 1
+			for end < len(p.commands) && !isBlockStart(p.commands[end], "end") {
+				end++
+			}
+			if end == len(p.commands) {
+				return errors.Errorf("voice block %q has no end", cmd)
+			}
+			name := strings.ToLower(itemAt(strings.Fields(cmd), 1))
+			if name == "" {
+				return errors.Errorf("voice name is empty")
+			}
+			err := prj.AddVoiceTemplate(name, p.commands[i+1:end])
+			if err != nil {
+				return errors.Wrapf(err, "voice %q", name)
+			}
+			i = end
+			continue
+		}
+
 		prjFunc, err := p.parseCommand(cmd)
 		if err != nil {
-			return nil, errors.Wrapf(err, "parse command %q", cmd)
+			return errors.Wrapf(err, "parse command %q", cmd)
 		}
 		err = prjFunc(prj)
 		if err != nil {
-			return nil, errors.Wrapf(err, "exec project-func for cmd %q", cmd)
+			return errors.Wrapf(err, "exec project-func for cmd %q", cmd)
 		}
 	}
 
-	return prj, nil
+	return nil
+}
+
+// isBlockStart returns true, if the first item of cmd is keyword
+func isBlockStart(cmd string, keyword string) bool {
+	return strings.ToLower(firstItem(strings.Fields(cmd))) == keyword
 }
 
 func (p *parser) parseCommand(cmd string) (projectFunc, error) {
 	sl := strings.Split(cmd, " ")
 	var items []string
+	p.rawItems = nil
 	for _, s := range sl {
-		item := strings.ToLower(strings.Trim(s, " \r\n\t"))
-		if item == "" {
+		raw := strings.Trim(s, " \r\n\t")
+		if raw == "" {
 			continue
 		}
-		items = append(items, item)
+		items = append(items, strings.ToLower(raw))
+		p.rawItems = append(p.rawItems, raw)
 	}
 
 	prefix := firstItem(items)
 	rest := spliceItems(items, 0)
+	if p.inVoice {
+		switch prefix {
+		case "add", "connect", "output", "set", "keytrack":
+		default:
+			return nil, errors.Errorf("%q is not allowed in a voice", prefix)
+		}
+	}
 	switch prefix {
 	case "add":
 		return p.parseAdd(rest)
@@ -94,6 +159,10 @@ func (p *parser) parseCommand(cmd string) (projectFunc, error) {
 		return p.parseAssignKeys(rest)
 	case "bind_key":
 		return p.parseBindKey(rest)
+	case "keytrack":
+		return p.parseKeytrack(rest)
+	case "end":
+		return nil, errors.Errorf("end without voice block")
 	default:
 		return nil, errors.Errorf("invalid prefix %q", prefix)
 	}
@@ -115,6 +184,36 @@ func (p *parser) parseAdd(items []string) (projectFunc, error) {
 		return p.parseAddFilter(name, rest)
 	case "oscpool":
 		return p.parseAddOscPool(name, rest)
+	case "pan":
+		return p.parseAddPan(name, rest)
+	case "wavetable":
+		return p.parseAddWavetable(name, rest)
+	case "fm":
+		return p.parseAddFM(name, rest)
+	case "noise":
+		return p.parseAddNoise(name, rest)
+	case "biquad":
+		return p.parseAddBiquad(name, rest)
+	case "ladder":
+		return p.parseAddLadder(name, rest)
+	case "svf":
+		return p.parseAddSVF(name, rest)
+	case "eq":
+		return p.parseAddEQ(name, rest)
+	case "delay":
+		return p.parseAddDelay(name, rest)
+	case "reverb":
+		return p.parseAddReverb(name, rest)
+	case "chorus":
+		return p.parseAddChorus(name, rest)
+	case "flanger":
+		return p.parseAddFlanger(name, rest)
+	case "phaser":
+		return p.parseAddPhaser(name, rest)
+	case "env":
+		return p.parseAddEnv(name, rest)
+	case "amp":
+		return p.parseAddAmp(name, rest)
 	default:
 		return nil, errors.Errorf("unknown component %q", comp)
 	}
@@ -181,9 +280,257 @@ func (p *parser) parseAddMixer(name string, items []string) (projectFunc, error)
 	}, nil
 }
 
+/*
+add oscpool pool [voices] [voice]
+set pool type:blsquare attack:0.05 release:1 steal:quietest
+set pool unison:7 detune:0.2 spread:0.8 randomphase:true
+*/
+
 func (p *parser) parseAddOscPool(name string, items []string) (projectFunc, error) {
+	voices := 8
+	if len(items) > 0 {
+		err := scanItem(itemAt(items, 0), &voices)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse-add-oscpool: scan voices %v", items)
+		}
+	}
+	template := itemAt(items, 1)
 	return func(prj *Project) error {
-		return prj.AddOscillatorPool(name)
+		return prj.AddOscillatorPool(name, voices, template)
+	}, nil
+}
+
+/*
+keytrack comp [param] [ratio]
+*/
+
+func (p *parser) parseKeytrack(items []string) (projectFunc, error) {
+	if !p.inVoice {
+		return nil, errors.Errorf("keytrack is only allowed in a voice")
+	}
+	var (
+		name  string
+		param = "freq"
+		ratio = 1.0
+	)
+	err := scanItems(items, &name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse-keytrack: scan items %v", items)
+	}
+	if len(items) > 1 {
+		param = itemAt(items, 1)
+	}
+	if len(items) > 2 {
+		err = scanItem(itemAt(items, 2), &ratio)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse-keytrack: scan ratio %v", items)
+		}
+	}
+
+	return func(prj *Project) error {
+		return prj.AddKeytrack(name, param, ratio)
+	}, nil
+}
+
+func (p *parser) parseAddPan(name string, items []string) (projectFunc, error) {
+	var pan float64
+	law := string(wavx.PanLawConstantPower)
+	if len(items) > 0 {
+		err := scanItems(items, &pan)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse-add-pan: scan items %v", items)
+		}
+	}
+	if len(items) > 1 {
+		law = itemAt(items, 1)
+	}
+
+	return func(prj *Project) error {
+		return prj.AddPan(name, pan, law)
+	}, nil
+}
+
+/*
+add wavetable wt1 samples/table.wav 110 1 2048
+*/
+
+func (p *parser) parseAddWavetable(name string, items []string) (projectFunc, error) {
+	var (
+		file      string
+		freq      float64
+		ampl      float64
+		frameSize int
+	)
+	err := scanItems(items, &file, &freq, &ampl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse-add-wavetable: scan items %v", items)
+	}
+	if len(items) > 3 {
+		err = scanItem(itemAt(items, 3), &frameSize)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse-add-wavetable: scan frame-size %v", items)
+		}
+	}
+	// the file path keeps its case; it is the fourth item of "add wavetable <name> <file> ..."
+	file = itemAt(p.rawItems, 3)
+
+	return func(prj *Project) error {
+		return prj.AddWavetable(name, file, frameSize, freq, ampl)
+	}, nil
+}
+
+/*
+add fm fm1 220 1 4
+set fm1 algorithm:5 op2.ratio:2 op2.level:0.7
+*/
+
+func (p *parser) parseAddFM(name string, items []string) (projectFunc, error) {
+	var (
+		freq   float64
+		ampl   float64
+		numOps = 4
+	)
+	err := scanItems(items, &freq, &ampl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse-add-fm: scan items %v", items)
+	}
+	if len(items) > 2 {
+		err = scanItem(itemAt(items, 2), &numOps)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse-add-fm: scan operators %v", items)
+		}
+	}
+
+	return func(prj *Project) error {
+		return prj.AddFM(name, numOps, freq, ampl)
+	}, nil
+}
+
+func (p *parser) parseAddNoise(name string, items []string) (projectFunc, error) {
+	var (
+		color string
+		ampl  float64
+		seed  int64 = 1
+	)
+	err := scanItems(items, &color, &ampl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse-add-noise: scan items %v", items)
+	}
+	if len(items) > 2 {
+		err = scanItem(itemAt(items, 2), &seed)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse-add-noise: scan seed %v", items)
+		}
+	}
+
+	return func(prj *Project) error {
+		return prj.AddNoise(name, color, ampl, seed)
+	}, nil
+}
+
+/*
+add env env1 adsr 0.01 0.2 0.7 0.5
+add env env2 dahdsr 0.1 0.01 0.2 0.3 0.5 1
+add env env3 points 0:0 0.1:1 0.5:0.3:exp loop 1-2 release 0.5
+connect env1 filter1:cutoff-modulation
+set env1 attackcurve:log releasecurve:exp mode:legato
+set env1 gate:on
+*/
+
+func (p *parser) parseAddEnv(name string, items []string) (projectFunc, error) {
+	typ := itemAt(items, 0)
+	switch typ {
+	case "adsr":
+		var attack, decay, sustain, release float64
+		err := scanItems(spliceItems(items, 0), &attack, &decay, &sustain, &release)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse-add-env: scan items %v", items)
+		}
+		return func(prj *Project) error {
+			return prj.AddADSR(name, attack, decay, sustain, release)
+		}, nil
+	case "dahdsr":
+		var params wavx.EnvelopeParams
+		err := scanItems(spliceItems(items, 0), &params.Delay, &params.Attack, &params.Hold, &params.Decay, &params.Sustain, &params.Release)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse-add-env: scan items %v", items)
+		}
+		return func(prj *Project) error {
+			return prj.AddEnvelope(name, params)
+		}, nil
+	case "points":
+		params, err := parseEnvelopePoints(spliceItems(items, 0))
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse-add-env: %v", items)
+		}
+		return func(prj *Project) error {
+			return prj.AddEnvelope(name, params)
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown envelope type %q", typ)
+	}
+}
+
+// parseEnvelopePoints parses breakpoints <time>:<level>[:<curve>], followed by an optional loop <start>-<end> and release <secs>
+func parseEnvelopePoints(items []string) (wavx.EnvelopeParams, error) {
+	params := wavx.EnvelopeParams{
+		Release: 0.1,
+	}
+	for i := 0; i < len(items); i++ {
+		item := items[i]
+		switch item {
+		case "loop":
+			i++
+			sl := strings.Split(itemAt(items, i), "-")
+			if len(sl) != 2 {
+				return params, errors.Errorf("invalid loop %q", itemAt(items, i))
+			}
+			if err := scanItems(sl, &params.LoopStart, &params.LoopEnd); err != nil {
+				return params, errors.Wrapf(err, "scan loop %q", itemAt(items, i))
+			}
+		case "release":
+			i++
+			if err := scanItem(itemAt(items, i), &params.Release); err != nil {
+				return params, errors.Wrapf(err, "scan release %q", itemAt(items, i))
+			}
+		default:
+			sl := strings.Split(item, ":")
+			if len(sl) < 2 || len(sl) > 3 {
+				return params, errors.Errorf("invalid point %q", item)
+			}
+			var pt wavx.EnvelopePoint
+			if err := scanItems(sl[:2], &pt.Time, &pt.Level); err != nil {
+				return params, errors.Wrapf(err, "scan point %q", item)
+			}
+			if len(sl) == 3 {
+				pt.Curve = wavx.EnvelopeCurve(sl[2])
+			}
+			params.Points = append(params.Points, pt)
+		}
+	}
+	if len(params.Points) == 0 {
+		return params, errors.Errorf("no points")
+	}
+	return params, nil
+}
+
+/*
+add amp amp1 0
+connect osc1 amp1:signal
+connect env1 amp1:modulation
+*/
+
+func (p *parser) parseAddAmp(name string, items []string) (projectFunc, error) {
+	ampl := 1.0
+	if len(items) > 0 {
+		err := scanItem(itemAt(items, 0), &ampl)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse-add-amp: scan ampl %v", items)
+		}
+	}
+
+	return func(prj *Project) error {
+		return prj.AddAmplituder(name, ampl)
 	}, nil
 }
 
@@ -203,6 +550,294 @@ func (p *parser) parseAddFilter(name string, items []string) (projectFunc, error
 	}, nil
 }
 
+/*
+add biquad bq1 lowpass 800 0.707
+add biquad bq2 peaking 2500 1.5 -6
+connect env1 bq1:cutoff-octave-modulation
+*/
+
+func (p *parser) parseAddBiquad(name string, items []string) (projectFunc, error) {
+	var (
+		typ    string
+		cutoff float64
+		q      float64
+		gain   float64
+	)
+	err := scanItems(items, &typ, &cutoff, &q)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse-add-biquad: scan items %v", items)
+	}
+	if len(items) > 3 {
+		err = scanItem(itemAt(items, 3), &gain)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse-add-biquad: scan gain %v", items)
+		}
+	}
+
+	return func(prj *Project) error {
+		return prj.AddBiquad(name, typ, cutoff, q, gain)
+	}, nil
+}
+
+/*
+add ladder lad1 800 0.5
+add ladder lad2 1200 0.8 12
+connect env1 lad1:cutoff-octave-modulation
+*/
+
+func (p *parser) parseAddLadder(name string, items []string) (projectFunc, error) {
+	var (
+		cutoff    float64
+		resonance float64
+		slope     = 24
+	)
+	err := scanItems(items, &cutoff, &resonance)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse-add-ladder: scan items %v", items)
+	}
+	if len(items) > 2 {
+		err = scanItem(itemAt(items, 2), &slope)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse-add-ladder: scan slope %v", items)
+		}
+	}
+
+	return func(prj *Project) error {
+		return prj.AddLadder(name, cutoff, resonance, slope)
+	}, nil
+}
+
+/*
+add svf svf1 lowpass 800 0.5
+add svf svf2 bandpass 1200 0.8 24
+connect svf1:highpass mix1
+output svf1:bandpass
+*/
+
+func (p *parser) parseAddSVF(name string, items []string) (projectFunc, error) {
+	var (
+		mode      string
+		cutoff    float64
+		resonance float64
+		slope     = 12
+	)
+	err := scanItems(items, &mode, &cutoff, &resonance)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse-add-svf: scan items %v", items)
+	}
+	if len(items) > 3 {
+		err = scanItem(itemAt(items, 3), &slope)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse-add-svf: scan slope %v", items)
+		}
+	}
+
+	return func(prj *Project) error {
+		return prj.AddSVF(name, mode, cutoff, resonance, slope)
+	}, nil
+}
+
+/*
+add eq eq1 lowcut:40 lowshelf:200:-3 peak:2500:4:2 highcut:16000
+set eq1 band3.gain:+3
+*/
+
+func (p *parser) parseAddEQ(name string, items []string) (projectFunc, error) {
+	var bands []wavx.EQBand
+	for _, item := range items {
+		band, err := parseEQBand(item)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse-add-eq: %v", items)
+		}
+		bands = append(bands, band)
+	}
+
+	return func(prj *Project) error {
+		return prj.AddEQ(name, bands)
+	}, nil
+}
+
+// parseEQBand parses a band <type>:<freq>[:<gain>[:<q>]]; q defaults to 0.707
+func parseEQBand(item string) (wavx.EQBand, error) {
+	band := wavx.EQBand{
+		Q: 1 / math.Sqrt2,
+	}
+	sl := strings.Split(item, ":")
+	if len(sl) < 2 || len(sl) > 4 {
+		return band, errors.Errorf("invalid band %q", item)
+	}
+	band.Type = wavx.EQBandType(sl[0])
+	if err := scanItem(sl[1], &band.Freq); err != nil {
+		return band, errors.Wrapf(err, "scan freq %q", item)
+	}
+	if len(sl) > 2 {
+		if err := scanItem(sl[2], &band.Gain); err != nil {
+			return band, errors.Wrapf(err, "scan gain %q", item)
+		}
+	}
+	if len(sl) > 3 {
+		if err := scanItem(sl[3], &band.Q); err != nil {
+			return band, errors.Wrapf(err, "scan q %q", item)
+		}
+	}
+	return band, nil
+}
+
+/*
+add delay dl1 350 feedback 0.4 mix 0.3
+add delay dl2 1/8d tempo 120 feedback 0.5 damping 0.3 mix 0.25 pingpong
+connect osc1 dl1
+*/
+
+func (p *parser) parseAddDelay(name string, items []string) (projectFunc, error) {
+	params := wavx.DelayParams{
+		Feedback: 0.3,
+		Mix:      0.5,
+	}
+	delayTime := itemAt(items, 0)
+	if strings.Contains(delayTime, "/") {
+		params.Division = delayTime
+	} else if err := scanItem(delayTime, &params.Time); err != nil {
+		return nil, errors.Wrapf(err, "parse-add-delay: scan time %v", items)
+	}
+	err := scanOptions(items[1:], map[string]interface{}{
+		"tempo":    &params.Tempo,
+		"feedback": &params.Feedback,
+		"damping":  &params.Damping,
+		"mix":      &params.Mix,
+		"pingpong": &params.PingPong,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse-add-delay: %v", items)
+	}
+
+	return func(prj *Project) error {
+		return prj.AddDelay(name, params)
+	}, nil
+}
+
+/*
+add reverb rv1
+add reverb rv2 roomsize 0.8 damping 0.3 width 1 predelay 20 mix 0.3
+connect mix1 rv1
+*/
+
+func (p *parser) parseAddReverb(name string, items []string) (projectFunc, error) {
+	params := wavx.ReverbParams{
+		RoomSize: 0.5,
+		Damping:  0.5,
+		Width:    1,
+		Mix:      0.5,
+	}
+	err := scanOptions(items, map[string]interface{}{
+		"roomsize": &params.RoomSize,
+		"damping":  &params.Damping,
+		"width":    &params.Width,
+		"predelay": &params.PreDelay,
+		"mix":      &params.Mix,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse-add-reverb: %v", items)
+	}
+
+	return func(prj *Project) error {
+		return prj.AddReverb(name, params)
+	}, nil
+}
+
+/*
+add chorus ch1
+add chorus ch2 voices 4 delay 15 depth 4 rate 0.6 spread 0.8 feedback 0.2 mix 0.4
+connect lfo1 ch2:delay-modulation
+*/
+
+func (p *parser) parseAddChorus(name string, items []string) (projectFunc, error) {
+	params := wavx.ChorusParams{
+		Delay:  20,
+		Depth:  5,
+		Rate:   0.8,
+		Voices: 3,
+		Spread: 1,
+		Mix:    0.5,
+	}
+	err := scanOptions(items, map[string]interface{}{
+		"delay":    &params.Delay,
+		"depth":    &params.Depth,
+		"rate":     &params.Rate,
+		"voices":   &params.Voices,
+		"spread":   &params.Spread,
+		"feedback": &params.Feedback,
+		"mix":      &params.Mix,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse-add-chorus: %v", items)
+	}
+
+	return func(prj *Project) error {
+		return prj.AddChorus(name, params)
+	}, nil
+}
+
+/*
+add flanger fl1
+add flanger fl2 delay 2 depth 1.5 rate 0.2 feedback 0.7 mix 0.5
+*/
+
+func (p *parser) parseAddFlanger(name string, items []string) (projectFunc, error) {
+	params := wavx.FlangerParams{
+		Delay:    3,
+		Depth:    2,
+		Rate:     0.25,
+		Feedback: 0.5,
+		Mix:      0.5,
+	}
+	err := scanOptions(items, map[string]interface{}{
+		"delay":    &params.Delay,
+		"depth":    &params.Depth,
+		"rate":     &params.Rate,
+		"feedback": &params.Feedback,
+		"mix":      &params.Mix,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse-add-flanger: %v", items)
+	}
+
+	return func(prj *Project) error {
+		return prj.AddFlanger(name, params)
+	}, nil
+}
+
+/*
+add phaser ph1
+add phaser ph2 freq 800 depth 2 rate 0.3 stages 6 feedback 0.6 mix 0.5
+*/
+
+func (p *parser) parseAddPhaser(name string, items []string) (projectFunc, error) {
+	params := wavx.PhaserParams{
+		Freq:     1000,
+		Depth:    1.5,
+		Rate:     0.5,
+		Stages:   4,
+		Feedback: 0.5,
+		Mix:      0.5,
+	}
+	err := scanOptions(items, map[string]interface{}{
+		"freq":     &params.Freq,
+		"depth":    &params.Depth,
+		"rate":     &params.Rate,
+		"stages":   &params.Stages,
+		"feedback": &params.Feedback,
+		"mix":      &params.Mix,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse-add-phaser: %v", items)
+	}
+
+	return func(prj *Project) error {
+		return prj.AddPhaser(name, params)
+	}, nil
+}
+
 func (p *parser) parseSleep(items []string) (projectFunc, error) {
 	dur, err := time.ParseDuration(firstItem(items))
 	if err != nil {
@@ -250,6 +885,12 @@ func (p *parser) parseSet(items []string) (projectFunc, error) {
 		cmd[k] = v
 	}
 
+	if p.inVoice {
+		// a voice has no events, so the params are set when the voice is built
+		return func(prj *Project) error {
+			return prj.Execute(name, cmd)
+		}, nil
+	}
 	return func(prj *Project) error {
 		prj.AddEvents(
 			ProjectEvent{
@@ -0,0 +1,278 @@
+package wavl
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mazzegi/wavx"
+)
+
+const voiceTestProject = `
+voice lead
+add osc osc1 blsaw 110 0.5 0
+add fm fm1 220 1 2
+set fm1 op2.ratio:2 op2.level:0.5
+set osc1 ampl:0.25
+keytrack osc1
+keytrack fm1 freq 2
+add mixer mix
+connect osc1 mix
+connect fm1 mix
+output mix
+end
+add oscpool pool 4 lead
+output pool
+`
+
+func TestParseVoice(t *testing.T) {
+	prj, err := Parse(strings.NewReader(voiceTestProject))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	tmpl, ok := prj.voiceTemplates["lead"]
+	if !ok {
+		t.Fatalf("no voice %q", "lead")
+	}
+	v, err := tmpl.NewVoice()
+	if err != nil {
+		t.Fatalf("new voice: %v", err)
+	}
+	gv := v.(*graphVoice)
+	if len(gv.prj.keytracks) != 2 || gv.prj.keytracks[1].ratio != 2 {
+		t.Errorf("unexpected keytracks %+v", gv.prj.keytracks)
+	}
+	osc := gv.prj.components["osc1"].(*wavx.StdOscillator)
+	if ampl := osc.Parameters().Ampl; ampl != 0.25 {
+		t.Errorf("set in voice: want ampl 0.25, have %f", ampl)
+	}
+	if len(prj.events) != 0 {
+		t.Errorf("set in voice must not add project events, have %d", len(prj.events))
+	}
+	if _, ok := prj.components["pool"].(*wavx.OscillatorPool); !ok {
+		t.Errorf("no pool")
+	}
+}
+
+func TestParseVoiceErrors(t *testing.T) {
+	tests := map[string]struct {
+		src     string
+		wantErr string
+	}{
+		"nested": {
+			src:     "voice a\nvoice b\nadd osc osc1 sine 110 1 0\noutput osc1\nend",
+			wantErr: "nested voice block",
+		},
+		"missing end": {
+			src:     "voice a\nadd osc osc1 sine 110 1 0\noutput osc1",
+			wantErr: "has no end",
+		},
+		"stray end": {
+			src:     "add osc osc1 sine 110 1 0\nend",
+			wantErr: "end without voice block",
+		},
+		"empty name": {
+			src:     "voice\nadd osc osc1 sine 110 1 0\noutput osc1\nend",
+			wantErr: "voice name is empty",
+		},
+		"disallowed command": {
+			src:     "voice a\nadd osc osc1 sine 110 1 0\nsleep 1s\noutput osc1\nend",
+			wantErr: `"sleep" is not allowed in a voice`,
+		},
+		"set unknown component": {
+			src:     "voice a\nadd osc osc1 sine 110 1 0\nset osc2 ampl:0.5\noutput osc1\nend",
+			wantErr: `no such component "osc2"`,
+		},
+		"no output": {
+			src:     "voice a\nadd osc osc1 sine 110 1 0\nend",
+			wantErr: "has no output",
+		},
+		"duplicate": {
+			src:     "voice a\nadd osc osc1 sine 110 1 0\noutput osc1\nend\nvoice a\nadd osc osc1 sine 110 1 0\noutput osc1\nend",
+			wantErr: "already exists",
+		},
+		"keytrack outside voice": {
+			src:     "add osc osc1 sine 110 1 0\nkeytrack osc1",
+			wantErr: "keytrack is only allowed in a voice",
+		},
+		"unknown pool voice": {
+			src:     "add oscpool pool 4 lead",
+			wantErr: `no such voice "lead"`,
+		},
+	}
+	for name, test := range tests {
+		_, err := Parse(strings.NewReader(test.src))
+		if err == nil {
+			t.Errorf("%s: want error %q, have none", name, test.wantErr)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: want error %q, have %q", name, test.wantErr, err)
+		}
+	}
+}
+
+type parseTest struct {
+	src string
+	// comp is the component, whose Parameters() are compared to want after the set events have been applied
+	comp string
+	// method replaces Parameters, e.g. by Bands
+	method  string
+	want    interface{}
+	wantErr bool
+}
+
+var parseTests = []parseTest{
+	// env
+	{
+		src:  "add env env1 adsr 0.01 0.2 0.7 0.5",
+		comp: "env1",
+		want: wavx.EnvelopeParams{Attack: 0.01, Decay: 0.2, Sustain: 0.7, Release: 0.5},
+	},
+	{
+		src:  "add env env2 dahdsr 0.1 0.01 0.2 0.3 0.5 1",
+		comp: "env2",
+		want: wavx.EnvelopeParams{Delay: 0.1, Attack: 0.01, Hold: 0.2, Decay: 0.3, Sustain: 0.5, Release: 1},
+	},
+	{
+		src:  "add env env3 points 0:0 0.1:1 0.5:0.3:exp loop 1-2 release 0.5",
+		comp: "env3",
+		want: wavx.EnvelopeParams{
+			Points:    []wavx.EnvelopePoint{{Time: 0, Level: 0}, {Time: 0.1, Level: 1}, {Time: 0.5, Level: 0.3, Curve: wavx.EnvelopeCurve("exp")}},
+			LoopStart: 1,
+			LoopEnd:   2,
+			Release:   0.5,
+		},
+	},
+	{
+		src:  "add env env1 adsr 0.01 0.2 0.7 0.5\nset env1 attackcurve:log releasecurve:exp mode:legato",
+		comp: "env1",
+		want: wavx.EnvelopeParams{Attack: 0.01, Decay: 0.2, Sustain: 0.7, Release: 0.5, AttackCurve: "log", ReleaseCurve: "exp", Mode: "legato"},
+	},
+	{src: "add env env1 adsr 0.01 0.2 0.7", wantErr: true},
+	{src: "add env env3 points 0:0 0.1:1 loop 1", wantErr: true},
+	{src: "add env env3 points 0:0 0.1:1 loop 1-2", wantErr: true},
+	{src: "add env env4 ahdsr 0.1 0.2 0.3 0.4 0.5", wantErr: true},
+	// eq
+	{
+		src:    "add eq eq1 lowcut:40 lowshelf:200:-3 peak:2500:4:2 highcut:16000",
+		comp:   "eq1",
+		method: "Bands",
+		want: []wavx.EQBand{
+			{Type: wavx.EQLowCut, Freq: 40, Q: 1 / math.Sqrt2},
+			{Type: wavx.EQLowShelf, Freq: 200, Gain: -3, Q: 1 / math.Sqrt2},
+			{Type: wavx.EQPeak, Freq: 2500, Gain: 4, Q: 2},
+			{Type: wavx.EQHighCut, Freq: 16000, Q: 1 / math.Sqrt2},
+		},
+	},
+	{
+		src:    "add eq eq1 lowcut:40 lowshelf:200:-3 peak:2500:4:2 highcut:16000\nset eq1 band3.gain:+3",
+		comp:   "eq1",
+		method: "Bands",
+		want: []wavx.EQBand{
+			{Type: wavx.EQLowCut, Freq: 40, Q: 1 / math.Sqrt2},
+			{Type: wavx.EQLowShelf, Freq: 200, Gain: -3, Q: 1 / math.Sqrt2},
+			{Type: wavx.EQPeak, Freq: 2500, Gain: 7, Q: 2},
+			{Type: wavx.EQHighCut, Freq: 16000, Q: 1 / math.Sqrt2},
+		},
+	},
+	{src: "add eq eq1 peak:2500:4:2:1", wantErr: true},
+	{src: "add eq eq1 bell:2500", wantErr: true},
+	// delay
+	{
+		src:  "add delay dl1 350 feedback 0.4 mix 0.3",
+		comp: "dl1",
+		want: wavx.DelayParams{Time: 350, Feedback: 0.4, Mix: 0.3},
+	},
+	{
+		src:  "add delay dl2 1/8d tempo 120 feedback 0.5 damping 0.3 mix 0.25 pingpong",
+		comp: "dl2",
+		want: wavx.DelayParams{Division: "1/8d", Tempo: 120, Feedback: 0.5, Damping: 0.3, Mix: 0.25, PingPong: true},
+	},
+	{src: "add delay dl1 350 feedback", wantErr: true},
+	{src: "add delay dl1 350 wet 0.3", wantErr: true},
+	// reverb
+	{
+		src:  "add reverb rv1",
+		comp: "rv1",
+		want: wavx.ReverbParams{RoomSize: 0.5, Damping: 0.5, Width: 1, Mix: 0.5},
+	},
+	{
+		src:  "add reverb rv2 roomsize 0.8 damping 0.3 width 1 predelay 20 mix 0.3",
+		comp: "rv2",
+		want: wavx.ReverbParams{RoomSize: 0.8, Damping: 0.3, Width: 1, PreDelay: 20, Mix: 0.3},
+	},
+	{src: "add reverb rv1 roomsize large", wantErr: true},
+	// chorus, flanger and phaser
+	{
+		src:  "add chorus ch1",
+		comp: "ch1",
+		want: wavx.ChorusParams{Delay: 20, Depth: 5, Rate: 0.8, Voices: 3, Spread: 1, Mix: 0.5},
+	},
+	{
+		src:  "add chorus ch2 voices 4 delay 15 depth 4 rate 0.6 spread 0.8 feedback 0.2 mix 0.4",
+		comp: "ch2",
+		want: wavx.ChorusParams{Delay: 15, Depth: 4, Rate: 0.6, Voices: 4, Spread: 0.8, Feedback: 0.2, Mix: 0.4},
+	},
+	{src: "add chorus ch1 voices 2.5", wantErr: true},
+	{
+		src:  "add flanger fl1",
+		comp: "fl1",
+		want: wavx.FlangerParams{Delay: 3, Depth: 2, Rate: 0.25, Feedback: 0.5, Mix: 0.5},
+	},
+	{
+		src:  "add flanger fl2 delay 2 depth 1.5 rate 0.2 feedback 0.7 mix 0.5",
+		comp: "fl2",
+		want: wavx.FlangerParams{Delay: 2, Depth: 1.5, Rate: 0.2, Feedback: 0.7, Mix: 0.5},
+	},
+	{src: "add flanger fl1 voices 2", wantErr: true},
+	{
+		src:  "add phaser ph1",
+		comp: "ph1",
+		want: wavx.PhaserParams{Freq: 1000, Depth: 1.5, Rate: 0.5, Stages: 4, Feedback: 0.5, Mix: 0.5},
+	},
+	{
+		src:  "add phaser ph2 freq 800 depth 2 rate 0.3 stages 6 feedback 0.6 mix 0.5",
+		comp: "ph2",
+		want: wavx.PhaserParams{Freq: 800, Depth: 2, Rate: 0.3, Stages: 6, Feedback: 0.6, Mix: 0.5},
+	},
+	{src: "add phaser ph1 stages", wantErr: true},
+}
+
+func TestParseCommands(t *testing.T) {
+	for _, test := range parseTests {
+		prj, err := Parse(strings.NewReader(test.src))
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q: want error, have none", test.src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.src, err)
+			continue
+		}
+		for _, e := range prj.events {
+			if pe, ok := e.(ProjectEvent); ok {
+				pe.projFunc(prj)
+			}
+		}
+		if test.want == nil {
+			continue
+		}
+		comp, ok := prj.components[test.comp]
+		if !ok {
+			t.Errorf("%q: no component %q", test.src, test.comp)
+			continue
+		}
+		method := "Parameters"
+		if test.method != "" {
+			method = test.method
+		}
+		have := reflect.ValueOf(comp).MethodByName(method).Call(nil)[0].Interface()
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("%q: want %+v, have %+v", test.src, test.want, have)
+		}
+	}
+}
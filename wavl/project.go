@@ -3,6 +3,10 @@ package wavl
 import (
 	"context"
 	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
 
 	"github.com/mazzegi/wavx"
 	"github.com/mazzegi/wavx/wavl/keys"
@@ -19,19 +23,26 @@ type KeyBinding struct {
 
 type Project struct {
 	sampleRate      int
+	channels        int
 	components      map[string]wavx.InputOutputter
-	outputFrom      wavx.InputOutputter
+	memos           map[string]*wavx.Memo
+	outputFrom      wavx.Outputter
 	synth           *wavx.Synthesizer
 	events          []Event
 	assignedKeyComp wavx.InputOutputter
 	keyBindings     map[rune]KeyBinding
+	voiceTemplates  map[string]*voiceTemplate
+	keytracks       []keytrack
 }
 
 func NewProject() *Project {
 	p := &Project{
-		sampleRate:  wavx.SampelRate44100,
-		components:  map[string]wavx.InputOutputter{},
-		keyBindings: map[rune]KeyBinding{},
+		sampleRate:     wavx.SampelRate44100,
+		channels:       2,
+		components:     map[string]wavx.InputOutputter{},
+		memos:          map[string]*wavx.Memo{},
+		keyBindings:    map[rune]KeyBinding{},
+		voiceTemplates: map[string]*voiceTemplate{},
 	}
 
 	return p
@@ -45,14 +56,134 @@ func (p *Project) addComponent(name string, comp wavx.InputOutputter) error {
 	return nil
 }
 
-func (p *Project) AddOscillatorPool(name string) error {
-	return p.addComponent(name, wavx.NewOscillatorPool())
+// memo returns the memoized output of the component, which is shared by all of its consumers.
+// So each component is evaluated once per sample or block, no matter how many inputs it feeds.
+// The name may address a single output of a MultiOutputter, e.g. "svf1:highpass".
+func (p *Project) memo(name string) *wavx.Memo {
+	if m, ok := p.memos[name]; ok {
+		return m
+	}
+	op, _ := p.output(name)
+	m := wavx.NewMemo(op)
+	p.memos[name] = m
+	return m
+}
+
+// output returns the component name or, for "comp:output", the named output of a MultiOutputter
+func (p *Project) output(name string) (wavx.Outputter, error) {
+	sl := strings.SplitN(name, ":", 2)
+	compName := sl[0]
+	comp, ok := p.components[compName]
+	if !ok {
+		return nil, errors.Errorf("no such component %q", compName)
+	}
+	if len(sl) == 1 {
+		return comp, nil
+	}
+	outName := sl[1]
+	mo, ok := comp.(wavx.MultiOutputter)
+	if !ok {
+		return nil, errors.Errorf("component %q has no outputs", compName)
+	}
+	op, ok := mo.OutputOf(outName)
+	if !ok {
+		return nil, errors.Errorf("component %q has no output %q", compName, outName)
+	}
+	return op, nil
+}
+
+// SetChannels sets the number of output channels (1 or 2)
+func (p *Project) SetChannels(n int) error {
+	if n != 1 && n != 2 {
+		return errors.Errorf("unsupported number of channels %d", n)
+	}
+	p.channels = n
+	return nil
+}
+
+// AddOscillatorPool adds a pool of voices; the voices of a pool with a template are built from the voice block of that name
+func (p *Project) AddOscillatorPool(name string, voices int, template string) error {
+	pool := wavx.NewOscillatorPool(voices)
+	if template != "" {
+		t, ok := p.voiceTemplates[template]
+		if !ok {
+			return errors.Errorf("no such voice %q", template)
+		}
+		err := pool.SetTemplate(t)
+		if err != nil {
+			return errors.Wrapf(err, "set voice %q", template)
+		}
+	}
+	return p.addComponent(name, pool)
+}
+
+// AddVoiceTemplate adds the voice block name. The commands are checked by building a first voice.
+func (p *Project) AddVoiceTemplate(name string, commands []string) error {
+	if _, ok := p.voiceTemplates[name]; ok {
+		return errors.Errorf("voice with name %q already exists", name)
+	}
+	t := &voiceTemplate{
+		name:     name,
+		commands: commands,
+	}
+	_, err := t.NewVoice()
+	if err != nil {
+		return err
+	}
+	p.voiceTemplates[name] = t
+	return nil
+}
+
+// AddKeytrack sets param of the component to ratio times the note frequency on each note-on of a voice
+func (p *Project) AddKeytrack(compName string, param string, ratio float64) error {
+	comp, ok := p.components[compName]
+	if !ok {
+		return errors.Errorf("no such component %q", compName)
+	}
+	p.keytracks = append(p.keytracks, keytrack{
+		comp:  comp,
+		param: param,
+		ratio: ratio,
+	})
+	return nil
 }
 
 func (p *Project) AddOscillator(name string, typ string, freq float64, ampl float64, overtones int) error {
 	return p.addComponent(name, wavx.NewStdOscillator(wavx.StdOscillatorType(typ), freq, ampl, overtones))
 }
 
+func (p *Project) AddWavetable(name string, file string, frameSize int, freq float64, ampl float64) error {
+	wt, err := wavx.NewWavetableOscillator(file, frameSize, freq, ampl)
+	if err != nil {
+		return errors.Wrapf(err, "new wavetable %q", name)
+	}
+	return p.addComponent(name, wt)
+}
+
+func (p *Project) AddFM(name string, numOps int, freq float64, ampl float64) error {
+	return p.addComponent(name, wavx.NewFMVoice(numOps, freq, ampl))
+}
+
+func (p *Project) AddNoise(name string, color string, ampl float64, seed int64) error {
+	return p.addComponent(name, wavx.NewNoise(wavx.NoiseColor(color), ampl, seed))
+}
+
+func (p *Project) AddADSR(name string, attack, decay, sustain, release float64) error {
+	return p.addComponent(name, wavx.NewADSR(attack, decay, sustain, release))
+}
+
+func (p *Project) AddEnvelope(name string, params wavx.EnvelopeParams) error {
+	env, err := wavx.NewEnvelopeComponent(params)
+	if err != nil {
+		return errors.Wrapf(err, "new envelope %q", name)
+	}
+	return p.addComponent(name, env)
+}
+
+func (p *Project) AddAmplituder(name string, ampl float64) error {
+	return p.addComponent(name, wavx.NewAmplituder(ampl))
+}
+
 func (p *Project) AddMixer(name string) error {
 	return p.addComponent(name, wavx.NewAdder())
 }
@@ -61,25 +192,85 @@ func (p *Project) AddFilter(name string, typ string, cutoff float64, resonance f
 	return p.addComponent(name, wavx.NewFilter(wavx.FilterMode(typ), cutoff, resonance))
 }
 
+func (p *Project) AddBiquad(name string, typ string, cutoff float64, q float64, gain float64) error {
+	return p.addComponent(name, wavx.NewBiquad(wavx.BiquadType(typ), cutoff, q, gain))
+}
+
+func (p *Project) AddLadder(name string, cutoff float64, resonance float64, slope int) error {
+	if slope != 12 && slope != 24 {
+		return errors.Errorf("unsupported slope %d", slope)
+	}
+	return p.addComponent(name, wavx.NewLadder(cutoff, resonance, slope))
+}
+
+func (p *Project) AddSVF(name string, mode string, cutoff float64, resonance float64, slope int) error {
+	if slope != 12 && slope != 24 {
+		return errors.Errorf("unsupported slope %d", slope)
+	}
+	return p.addComponent(name, wavx.NewSVF(wavx.SVFMode(mode), cutoff, resonance, slope))
+}
+
+func (p *Project) AddEQ(name string, bands []wavx.EQBand) error {
+	eq, err := wavx.NewEQ(bands...)
+	if err != nil {
+		return errors.Wrapf(err, "eq %q", name)
+	}
+	return p.addComponent(name, eq)
+}
+
+func (p *Project) AddDelay(name string, params wavx.DelayParams) error {
+	d, err := wavx.NewDelay(params)
+	if err != nil {
+		return errors.Wrapf(err, "delay %q", name)
+	}
+	return p.addComponent(name, d)
+}
+
+func (p *Project) AddReverb(name string, params wavx.ReverbParams) error {
+	r := wavx.NewReverb(float64(p.sampleRate))
+	r.ChangeParameters(params)
+	return p.addComponent(name, r)
+}
+
+func (p *Project) AddChorus(name string, params wavx.ChorusParams) error {
+	c := wavx.NewChorus(params.Delay, params.Depth, params.Rate, params.Voices)
+	c.ChangeParameters(params)
+	return p.addComponent(name, c)
+}
+
+func (p *Project) AddFlanger(name string, params wavx.FlangerParams) error {
+	f := wavx.NewFlanger(params.Delay, params.Depth, params.Rate)
+	f.ChangeParameters(params)
+	return p.addComponent(name, f)
+}
+
+func (p *Project) AddPhaser(name string, params wavx.PhaserParams) error {
+	ph := wavx.NewPhaser(params.Freq, params.Depth, params.Rate, params.Stages)
+	ph.ChangeParameters(params)
+	return p.addComponent(name, ph)
+}
+
+func (p *Project) AddPan(name string, pan float64, law string) error {
+	return p.addComponent(name, wavx.NewPan(pan, wavx.PanLaw(law)))
+}
+
 func (p *Project) Connect(fromName string, toName string, input string) error {
-	from, ok := p.components[fromName]
-	if !ok {
-		return errors.Errorf("no such component %q", fromName)
+	if _, err := p.output(fromName); err != nil {
+		return err
 	}
 	to, ok := p.components[toName]
 	if !ok {
 		return errors.Errorf("no such component %q", toName)
 	}
-	to.ConnectInput(input, from)
+	to.ConnectInput(input, p.memo(fromName))
 	return nil
 }
 
 func (p *Project) OutputFrom(name string) error {
-	in, ok := p.components[name]
-	if !ok {
-		return errors.Errorf("no such component %q", name)
+	if _, err := p.output(name); err != nil {
+		return err
 	}
-	p.outputFrom = in
+	p.outputFrom = p.memo(name)
 	return nil
 }
 
@@ -87,29 +278,87 @@ func (p *Project) AddEvents(es ...Event) {
 	p.events = append(p.events, es...)
 }
 
+// Start plays the project on the default audio device
 func (p *Project) Start() error {
+	return p.StartWith(wavx.NewPortaudioSink())
+}
+
+// StartWith runs the project into sink
+func (p *Project) StartWith(sink wavx.AudioSink) error {
 	if p.synth != nil {
 		return errors.Errorf("synth is already running")
 	}
 	if p.outputFrom == nil {
 		return errors.Errorf("no output from set")
 	}
-	p.synth = wavx.NewSynthesizer(p.sampleRate, p.outputFrom)
+	p.synth = wavx.NewSynthesizer(p.sampleRate, p.outputFrom, sink)
+	p.synth.SetChannels(p.channels)
 	err := p.synth.Open()
 	if err != nil {
+		p.synth = nil
 		return errors.Wrap(err, "open synth")
 	}
 	err = p.synth.Start()
 	if err != nil {
+		p.synth.Close()
+		p.synth = nil
 		return errors.Wrap(err, "start synth")
 	}
 	return nil
 }
 
+// Render renders duration of the output component as 16 bit PCM WAV to w
+func (p *Project) Render(w io.Writer, duration time.Duration) error {
+	return p.RenderFormat(w, duration, wavx.WavFormatPCM16)
+}
+
+// RenderFormat renders duration of the output component as WAV to w without opening an audio device.
+// The project events are processed in sample time, so the result is reproducible.
+func (p *Project) RenderFormat(w io.Writer, duration time.Duration, format wavx.WavSampleFormat) error {
+	if p.synth != nil {
+		return errors.Errorf("synth is already running")
+	}
+	if p.outputFrom == nil {
+		return errors.Errorf("no output from set")
+	}
+	numFrames := int(math.Round(duration.Seconds() * float64(p.sampleRate)))
+	ww, err := wavx.NewWavWriter(w, p.sampleRate, p.channels, format, numFrames)
+	if err != nil {
+		return errors.Wrap(err, "new wav-writer")
+	}
+
+	synth := wavx.NewSynthesizer(p.sampleRate, p.outputFrom, nil)
+	synth.SetChannels(p.channels)
+	buf := make([]float64, wavx.DefaultFramesPerBuffer*p.channels)
+	render := func(n int) error {
+		for n > 0 {
+			chunk := buf
+			if n*p.channels < len(chunk) {
+				chunk = chunk[:n*p.channels]
+			}
+			synth.Render(chunk)
+			err := ww.Write(chunk)
+			if err != nil {
+				return err
+			}
+			n -= len(chunk) / p.channels
+		}
+		return nil
+	}
+
+	err = NewLooper(p.events).RunSamples(p, p.sampleRate, numFrames, render)
+	if err != nil {
+		return errors.Wrap(err, "render")
+	}
+	return ww.Close()
+}
+
 func (p *Project) Loop(ctx context.Context) {
 	l := NewLooper(p.events)
 	go l.Run(ctx, p)
-	if p.assignedKeyComp != nil {
+	if nr, ok := p.assignedKeyComp.(wavx.NoteReceiver); ok {
+		p.loopNotes(ctx, nr)
+	} else if p.assignedKeyComp != nil {
 		active := false
 		p.assignedKeyComp.Deactivate()
 
@@ -184,6 +433,41 @@ func (p *Project) Loop(ctx context.Context) {
 	}
 }
 
+// loopNotes plays the assigned polyphonic component: a key starts its note and stops it when pressed again,
+// space stops all notes
+func (p *Project) loopNotes(ctx context.Context, nr wavx.NoteReceiver) {
+	p.assignedKeyComp.Activate()
+	kl, err := keys.NewListener()
+	if err != nil {
+		panic(fmt.Sprintf("new key-listener: %v", err))
+	}
+	log.Infof("listen to events")
+	kc := kl.ListenCtx(ctx)
+	held := map[rune]bool{}
+	oct := 4
+	for e := range kc {
+		log.Infof("evt: %q", string(e))
+		if note, ok := keys2notes[e]; ok {
+			if held[e] {
+				nr.NoteOff(int(e))
+				delete(held, e)
+				continue
+			}
+			note.octave = oct
+			nr.NoteOn(int(e), note.Freq())
+			held[e] = true
+		} else if e >= '1' && e <= '9' {
+			oct = int(e - '0')
+		} else if e == ' ' {
+			nr.AllNotesOff()
+			held = map[rune]bool{}
+		} else if kb, ok := p.keyBindings[e]; ok {
+			log.Infof("send command to comp")
+			kb.Component.Execute(kb.Command)
+		}
+	}
+}
+
 func (p *Project) Stop() error {
 	if p.synth == nil {
 		return errors.Errorf("synth is not running")
@@ -0,0 +1,63 @@
+package wavl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mazzegi/wavx"
+)
+
+const renderTestProject = `
+add osc osc1 sine 441 0.5 0
+output osc1
+sleep 10ms
+set osc1 ampl:0
+`
+
+func renderTestBytes(t *testing.T, duration time.Duration) []byte {
+	prj, err := Parse(strings.NewReader(renderTestProject))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	buf := &bytes.Buffer{}
+	err = prj.Render(buf, duration)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestProjectRender(t *testing.T) {
+	duration := 20 * time.Millisecond
+	first := renderTestBytes(t, duration)
+	second := renderTestBytes(t, duration)
+	if !bytes.Equal(first, second) {
+		t.Fatalf("renders differ")
+	}
+
+	// 16 bit PCM stereo: 44 bytes of header, 4 bytes per frame
+	const headerSize = 44
+	const blockAlign = 4
+	numFrames := int(duration.Seconds() * wavx.SampelRate44100)
+	dataSize := int(binary.LittleEndian.Uint32(first[headerSize-4 : headerSize]))
+	if dataSize != numFrames*blockAlign || len(first) != headerSize+dataSize {
+		t.Fatalf("want %d frames, have %d in header and %d in data", numFrames, dataSize/blockAlign, (len(first)-headerSize)/blockAlign)
+	}
+
+	// the amplitude is set to 0 after 10ms, i.e. on frame 441
+	setFrame := int(10 * time.Millisecond.Seconds() * wavx.SampelRate44100)
+	frame := func(i int) int16 {
+		return int16(binary.LittleEndian.Uint16(first[headerSize+i*blockAlign:]))
+	}
+	if frame(setFrame-1) == 0 {
+		t.Errorf("frame %d: want signal, have silence", setFrame-1)
+	}
+	for i := setFrame; i < numFrames; i++ {
+		if frame(i) != 0 {
+			t.Fatalf("frame %d: want silence, have %d", i, frame(i))
+		}
+	}
+}
@@ -46,6 +46,30 @@ func scanItems(sl []string, vs ...interface{}) error {
 	return nil
 }
 
+// scanOptions scans pairs of <option> <value> into the values of opts. Options with a *bool value are flags
+// without a value, which are set to true.
+func scanOptions(sl []string, opts map[string]interface{}) error {
+	for i := 0; i < len(sl); i += 2 {
+		v, ok := opts[sl[i]]
+		if !ok {
+			return errors.Errorf("invalid option %q", sl[i])
+		}
+		if flag, ok := v.(*bool); ok {
+			*flag = true
+			i--
+			continue
+		}
+		if i+1 >= len(sl) {
+			return errors.Errorf("option %q has no value", sl[i])
+		}
+		err := scanItem(sl[i+1], v)
+		if err != nil {
+			return errors.Wrapf(err, "scan-option %q", sl[i])
+		}
+	}
+	return nil
+}
+
 func scanItem(item string, v interface{}) error {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Ptr {
@@ -0,0 +1,98 @@
+package wavl
+
+import (
+	"fmt"
+
+	"github.com/mazzegi/wavx"
+	"github.com/pkg/errors"
+)
+
+type keytrack struct {
+	comp  wavx.InputOutputter
+	param string
+	ratio float64
+}
+
+// voiceTemplate builds the voices of a pool from the commands of a voice block
+type voiceTemplate struct {
+	name     string
+	commands []string
+}
+
+// NewVoice builds a new subgraph of the voice block
+func (t *voiceTemplate) NewVoice() (wavx.Voice, error) {
+	prs := newParser(t.commands)
+	prs.inVoice = true
+	prj := NewProject()
+	err := prs.parseInto(prj)
+	if err != nil {
+		return nil, err
+	}
+	if prj.outputFrom == nil {
+		return nil, errors.Errorf("voice %q has no output", t.name)
+	}
+	v := &graphVoice{
+		prj: prj,
+	}
+	for _, comp := range prj.components {
+		if g, ok := comp.(wavx.Gater); ok {
+			v.gaters = append(v.gaters, g)
+		}
+		if ps, ok := comp.(wavx.PhaseSetter); ok {
+			v.phaseSetters = append(v.phaseSetters, ps)
+		}
+	}
+	return v, nil
+}
+
+// graphVoice is a voice of a pool. Note-on applies the keytracks and gates the envelopes of the subgraph.
+// A subgraph without envelopes is activated by note-on and deactivated by note-off.
+// The random phase of the pool applies to all oscillators of the subgraph.
+type graphVoice struct {
+	prj          *Project
+	gaters       []wavx.Gater
+	phaseSetters []wavx.PhaseSetter
+}
+
+func (v *graphVoice) SetPhase(phase float64) {
+	for _, ps := range v.phaseSetters {
+		ps.SetPhase(phase)
+	}
+}
+
+func (v *graphVoice) NoteOn(freq float64) {
+	for _, kt := range v.prj.keytracks {
+		kt.comp.Execute(wavx.Command{
+			kt.param: fmt.Sprintf("%f", freq*kt.ratio),
+		})
+	}
+	if len(v.gaters) == 0 {
+		for _, comp := range v.prj.components {
+			comp.Activate()
+		}
+		return
+	}
+	for _, g := range v.gaters {
+		g.GateOn()
+	}
+}
+
+func (v *graphVoice) NoteOff() {
+	if len(v.gaters) == 0 {
+		for _, comp := range v.prj.components {
+			comp.Deactivate()
+		}
+		return
+	}
+	for _, g := range v.gaters {
+		g.GateOff()
+	}
+}
+
+func (v *graphVoice) Output(secs float64) float64 {
+	return v.prj.outputFrom.Output(secs)
+}
+
+func (v *graphVoice) Process(ctx *wavx.ProcessContext, out []float64) {
+	wavx.ProcessBlock(ctx, v.prj.outputFrom, out)
+}
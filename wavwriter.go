@@ -0,0 +1,201 @@
+package wavx
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+type WavSampleFormat string
+
+const (
+	WavFormatPCM16   WavSampleFormat = "pcm16"
+	WavFormatFloat32 WavSampleFormat = "float32"
+)
+
+func (f WavSampleFormat) bytesPerSample() int {
+	switch f {
+	case WavFormatFloat32:
+		return 4
+	default:
+		return 2
+	}
+}
+
+func (f WavSampleFormat) audioFormat() uint16 {
+	switch f {
+	case WavFormatFloat32:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// encodeSamples encodes samples as little endian values of format into buf, which is grown if required
+func encodeSamples(buf []byte, samples []float64, format WavSampleFormat) []byte {
+	bps := format.bytesPerSample()
+	n := len(samples) * bps
+	if cap(buf) < n {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	for i, v := range samples {
+		if v > 1 {
+			v = 1
+		} else if v < -1 {
+			v = -1
+		}
+		switch format {
+		case WavFormatFloat32:
+			binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(float32(v)))
+		default:
+			binary.LittleEndian.PutUint16(buf[i*2:], uint16(int16(math.Round(v*math.MaxInt16))))
+		}
+	}
+	return buf
+}
+
+// WavWriter writes interleaved float samples in the range [-1, 1] as a RIFF/WAVE file.
+// The header is written with the expected number of frames. If the underlying writer is an io.WriteSeeker,
+// the sizes in the header are corrected on Close to the number of frames which have actually been written.
+type WavWriter struct {
+	w             io.Writer
+	sampleRate    int
+	channels      int
+	format        WavSampleFormat
+	numFrames     int
+	written       int
+	headerWritten bool
+	buf           []byte
+}
+
+func NewWavWriter(w io.Writer, sampleRate int, channels int, format WavSampleFormat, numFrames int) (*WavWriter, error) {
+	switch format {
+	case WavFormatPCM16, WavFormatFloat32:
+	default:
+		return nil, errors.Errorf("unsupported wav sample format %q", format)
+	}
+	if channels < 1 {
+		return nil, errors.Errorf("invalid number of channels %d", channels)
+	}
+	return &WavWriter{
+		w:          w,
+		sampleRate: sampleRate,
+		channels:   channels,
+		format:     format,
+		numFrames:  numFrames,
+	}, nil
+}
+
+func (ww *WavWriter) headerSize() int {
+	if ww.format == WavFormatFloat32 {
+		// riff + fmt (18) + fact + data
+		return 12 + 8 + 18 + 8 + 4 + 8
+	}
+	return 12 + 8 + 16 + 8
+}
+
+func (ww *WavWriter) header(numFrames int) []byte {
+	bps := ww.format.bytesPerSample()
+	blockAlign := ww.channels * bps
+	dataSize := numFrames * blockAlign
+
+	h := make([]byte, 0, ww.headerSize())
+	var b [4]byte
+	u16 := func(v uint16) {
+		binary.LittleEndian.PutUint16(b[:], v)
+		h = append(h, b[:2]...)
+	}
+	u32 := func(v uint32) {
+		binary.LittleEndian.PutUint32(b[:], v)
+		h = append(h, b[:]...)
+	}
+
+	h = append(h, "RIFF"...)
+	u32(uint32(ww.headerSize() - 8 + dataSize))
+	h = append(h, "WAVE"...)
+
+	h = append(h, "fmt "...)
+	if ww.format == WavFormatFloat32 {
+		u32(18)
+	} else {
+		u32(16)
+	}
+	u16(ww.format.audioFormat())
+	u16(uint16(ww.channels))
+	u32(uint32(ww.sampleRate))
+	u32(uint32(ww.sampleRate * blockAlign))
+	u16(uint16(blockAlign))
+	u16(uint16(bps * 8))
+	if ww.format == WavFormatFloat32 {
+		// cbSize; non-PCM formats also require a fact chunk
+		u16(0)
+		h = append(h, "fact"...)
+		u32(4)
+		u32(uint32(numFrames))
+	}
+
+	h = append(h, "data"...)
+	u32(uint32(dataSize))
+	return h
+}
+
+// Write writes interleaved samples. len(samples) must be a multiple of the number of channels.
+func (ww *WavWriter) Write(samples []float64) error {
+	if len(samples)%ww.channels != 0 {
+		return errors.Errorf("number of samples (%d) is not a multiple of channels (%d)", len(samples), ww.channels)
+	}
+	if !ww.headerWritten {
+		_, err := ww.w.Write(ww.header(ww.numFrames))
+		if err != nil {
+			return errors.Wrap(err, "write header")
+		}
+		ww.headerWritten = true
+	}
+
+	ww.buf = encodeSamples(ww.buf, samples, ww.format)
+	_, err := ww.w.Write(ww.buf)
+	if err != nil {
+		return errors.Wrap(err, "write samples")
+	}
+	ww.written += len(samples) / ww.channels
+	return nil
+}
+
+// Close finalizes the header. It does not close the underlying writer.
+func (ww *WavWriter) Close() error {
+	if !ww.headerWritten {
+		ww.numFrames = 0
+		_, err := ww.w.Write(ww.header(0))
+		if err != nil {
+			return errors.Wrap(err, "write header")
+		}
+		ww.headerWritten = true
+		return nil
+	}
+	if ww.written == ww.numFrames {
+		return nil
+	}
+	ws, ok := ww.w.(io.WriteSeeker)
+	if !ok {
+		return errors.Errorf("wrote %d frames, but header declares %d", ww.written, ww.numFrames)
+	}
+	pos, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Wrap(err, "seek current")
+	}
+	start := pos - int64(ww.headerSize()+ww.written*ww.channels*ww.format.bytesPerSample())
+	_, err = ws.Seek(start, io.SeekStart)
+	if err != nil {
+		return errors.Wrap(err, "seek header")
+	}
+	_, err = ws.Write(ww.header(ww.written))
+	if err != nil {
+		return errors.Wrap(err, "rewrite header")
+	}
+	ww.numFrames = ww.written
+	_, err = ws.Seek(pos, io.SeekStart)
+	return err
+}
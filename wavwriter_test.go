@@ -0,0 +1,101 @@
+package wavx
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/youpy/go-wav"
+)
+
+func readWavSamples(t *testing.T, r interface {
+	io.Reader
+	io.ReaderAt
+}) (*wav.WavFormat, []wav.Sample) {
+	wr := wav.NewReader(r)
+	format, err := wr.Format()
+	if err != nil {
+		t.Fatalf("read format: %v", err)
+	}
+	var samples []wav.Sample
+	for {
+		smpls, err := wr.ReadSamples()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("read samples: %v", err)
+		}
+		samples = append(samples, smpls...)
+	}
+	return format, samples
+}
+
+func TestWavWriterPCM16(t *testing.T) {
+	in := []float64{0, 0.5, -0.5, 1, -1, 2}
+	buf := &bytes.Buffer{}
+	ww, err := NewWavWriter(buf, SampelRate44100, 1, WavFormatPCM16, len(in))
+	if err != nil {
+		t.Fatalf("new wav-writer: %v", err)
+	}
+	if err := ww.Write(in); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := ww.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	format, samples := readWavSamples(t, bytes.NewReader(buf.Bytes()))
+	if format.AudioFormat != wav.AudioFormatPCM || format.NumChannels != 1 || format.SampleRate != SampelRate44100 || format.BitsPerSample != 16 {
+		t.Fatalf("unexpected format %+v", format)
+	}
+	if len(samples) != len(in) {
+		t.Fatalf("want %d samples, have %d", len(in), len(samples))
+	}
+	want := []int{0, 16384, -16384, 32767, -32767, 32767}
+	for i, s := range samples {
+		if s.Values[0] != want[i] {
+			t.Errorf("sample %d: want %d, have %d", i, want[i], s.Values[0])
+		}
+	}
+}
+
+func TestWavWriterFloat32PatchesHeader(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.wav"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+
+	// declare no frames; the header must be corrected on close
+	ww, err := NewWavWriter(f, 48000, 2, WavFormatFloat32, 0)
+	if err != nil {
+		t.Fatalf("new wav-writer: %v", err)
+	}
+	in := []float64{0.25, -0.25, 0.5, -0.5, 0.75, -0.75}
+	if err := ww.Write(in); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := ww.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	f.Seek(0, io.SeekStart)
+	format, samples := readWavSamples(t, f)
+	if format.AudioFormat != wav.AudioFormatIEEEFloat || format.NumChannels != 2 || format.BitsPerSample != 32 {
+		t.Fatalf("unexpected format %+v", format)
+	}
+	if len(samples) != 3 {
+		t.Fatalf("want 3 frames, have %d", len(samples))
+	}
+	for i, s := range samples {
+		for c := 0; c < 2; c++ {
+			have := float64(s.Values[c]) / math.MaxInt32
+			if math.Abs(have-in[i*2+c]) > 1e-6 {
+				t.Errorf("frame %d, channel %d: want %f, have %f", i, c, in[i*2+c], have)
+			}
+		}
+	}
+}